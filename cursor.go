@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is the position of the last item on a page in a listing ordered
+// by (created_at, id). Clients only ever see it in its encoded, opaque form.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID uuid.UUID
+}
+
+func encodeCursor(c pageCursor) string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMicro(), 10) + "." + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	microsString, idString, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(microsString, 10, 64)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	return pageCursor{CreatedAt: time.UnixMicro(micros).UTC(), ID: id}, nil
+}
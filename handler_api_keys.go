@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrAPIKeyNameRequired = errors.New("api key name is required")
+var ErrAPIKeyScopesRequired = errors.New("api key needs at least one scope")
+var ErrAPIKeyExpiryInPast = errors.New("api key expiry must be in the future")
+var ErrAPIKeyCreatedByAPIKey = errors.New("api keys can only be created with an access token")
+
+type parametersAPIKey struct {
+	Name string `json:"name"`
+	Scopes []string `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type returnValueAPIKey struct {
+	Id uuid.UUID `json:"id"`
+	Name string `json:"name"`
+	// Key is only ever returned when the key is created.
+	Key string `json:"key,omitempty"`
+	Prefix string `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func apiKeyReturnValue(apiKey database.ApiKey) returnValueAPIKey {
+	return returnValueAPIKey{
+		Id: apiKey.ID,
+		Name: apiKey.Name,
+		Prefix: apiKey.Prefix,
+		Scopes: apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+		ExpiresAt: nullTimePtr(apiKey.ExpiresAt),
+		LastUsedAt: nullTimePtr(apiKey.LastUsedAt),
+		RevokedAt: nullTimePtr(apiKey.RevokedAt),
+	}
+}
+
+// handlerCreateAPIKey makes a personal API key for the caller. A key can only
+// be given scopes the credentials creating it already have. API keys can not
+// make more keys, as those would outlive the key that made them being revoked
+// or expiring.
+func (cfg *apiConfig) handlerCreateAPIKey(resWriter http.ResponseWriter, req *http.Request) {
+	principal, _ := principalFromContext(req.Context())
+	if principal.APIKeyID != uuid.Nil {
+		respondWithError(resWriter, http.StatusForbidden, ErrAPIKeyCreatedByAPIKey.Error(), ErrAPIKeyCreatedByAPIKey)
+		return
+	}
+
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersAPIKey{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding api key request data", err)
+		return
+	}
+	if params.Name == "" {
+		respondWithError(resWriter, http.StatusBadRequest, ErrAPIKeyNameRequired.Error(), ErrAPIKeyNameRequired)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		respondWithError(resWriter, http.StatusBadRequest, ErrAPIKeyScopesRequired.Error(), ErrAPIKeyScopesRequired)
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !principal.HasScope(scope) {
+			respondWithError(resWriter, http.StatusForbidden, "cannot grant the "+scope+" scope", nil)
+			return
+		}
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithError(resWriter, http.StatusBadRequest, ErrAPIKeyExpiryInPast.Error(), ErrAPIKeyExpiryInPast)
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error making api key", err)
+		return
+	}
+	apiKey, err := cfg.db.CreateAPIKey(req.Context(), database.CreateAPIKeyParams{
+		UserID: principal.UserID,
+		Name: params.Name,
+		KeyHash: auth.HashToken(key),
+		Prefix: prefix,
+		Scopes: params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error creating api key", err)
+		return
+	}
+	requestLogger(resWriter).Info("created api key", "api_key_id", apiKey.ID)
+
+	resVal := apiKeyReturnValue(apiKey)
+	resVal.Key = key
+	respondWithJSON(resWriter, http.StatusCreated, resVal)
+}
+
+// handlerGetAPIKeys lists the caller's API keys, revoked ones included.
+func (cfg *apiConfig) handlerGetAPIKeys(resWriter http.ResponseWriter, req *http.Request) {
+	apiKeys, err := cfg.db.ListAPIKeysByUserID(req.Context(), requestUserID(req))
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving api keys", err)
+		return
+	}
+	resVals := make([]returnValueAPIKey, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		resVals = append(resVals, apiKeyReturnValue(apiKey))
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVals)
+}
+
+func (cfg *apiConfig) handlerRevokeAPIKey(resWriter http.ResponseWriter, req *http.Request) {
+	keyID, err := uuid.Parse(req.PathValue("keyID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid api key id", err)
+		return
+	}
+	revoked, err := cfg.db.RevokeAPIKey(req.Context(), database.RevokeAPIKeyParams{ID: keyID, UserID: requestUserID(req)})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking api key", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(resWriter, http.StatusNotFound, "api key not found", sql.ErrNoRows)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
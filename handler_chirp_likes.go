@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+// countLikes fills in the like counts of resVals, and whether viewerID liked
+// each of them when it is a user.
+func (cfg *apiConfig) countLikes(ctx context.Context, viewerID uuid.UUID, resVals []*returnValueChirps) error {
+	if len(resVals) == 0 {
+		return nil
+	}
+	chirpIDs := make([]uuid.UUID, 0, len(resVals))
+	for _, resVal := range resVals {
+		chirpIDs = append(chirpIDs, resVal.Id)
+	}
+	counts, err := cfg.db.CountLikesByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	likeCounts := map[uuid.UUID]int64{}
+	for _, count := range counts {
+		likeCounts[count.ChirpID] = count.LikeCount
+	}
+	for _, resVal := range resVals {
+		resVal.LikeCount = likeCounts[resVal.Id]
+	}
+
+	if viewerID == uuid.Nil {
+		return nil
+	}
+	likedIDs, err := cfg.db.ListChirpIDsLikedByUser(ctx, database.ListChirpIDsLikedByUserParams{
+		UserID: viewerID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return err
+	}
+	liked := map[uuid.UUID]bool{}
+	for _, chirpID := range likedIDs {
+		liked[chirpID] = true
+	}
+	for _, resVal := range resVals {
+		likedByMe := liked[resVal.Id]
+		resVal.LikedByMe = &likedByMe
+	}
+	return nil
+}
+
+// handlerLikeChirp likes a chirp for the caller. Liking it again changes
+// nothing.
+func (cfg *apiConfig) handlerLikeChirp(resWriter http.ResponseWriter, req *http.Request) {
+	cfg.setChirpLike(resWriter, req, true)
+}
+
+// handlerUnlikeChirp takes back the caller's like, if there is one.
+func (cfg *apiConfig) handlerUnlikeChirp(resWriter http.ResponseWriter, req *http.Request) {
+	cfg.setChirpLike(resWriter, req, false)
+}
+
+func (cfg *apiConfig) setChirpLike(resWriter http.ResponseWriter, req *http.Request, like bool) {
+	userID := requestUserID(req)
+
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error parsing id from request", err)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), chirpID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "chirp not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error getting chirp", err)
+		return
+	}
+
+	if like {
+		err = cfg.db.LikeChirp(req.Context(), database.LikeChirpParams{UserID: userID, ChirpID: chirpID})
+	} else {
+		err = cfg.db.UnlikeChirp(req.Context(), database.UnlikeChirpParams{UserID: userID, ChirpID: chirpID})
+	}
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error updating like", err)
+		return
+	}
+
+	resVals, err := cfg.chirpReturnValues(req.Context(), userID, []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error counting replies and likes", err)
+		return
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVals[0])
+}
+
+// handlerGetUserLikes lists the chirps a user has liked, most recently liked
+// first. Deleted chirps are left out.
+func (cfg *apiConfig) handlerGetUserLikes(resWriter http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.pathUserID(resWriter, req)
+	if !ok {
+		return
+	}
+
+	chirps, err := cfg.db.ListChirpsLikedByUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error getting liked chirps", err)
+		return
+	}
+
+	resVals, err := cfg.chirpReturnValues(req.Context(), requestUserID(req), chirps)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error counting replies and likes", err)
+		return
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVals)
+}
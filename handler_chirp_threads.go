@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+type returnValueThreadChirp struct {
+	returnValueChirps
+	Depth int `json:"depth"`
+	Deleted bool `json:"deleted"`
+	Replies []*returnValueThreadChirp `json:"replies"`
+}
+
+// pruneTombstones drops deleted chirps that have nothing left below them and
+// reports whether the chirp itself should stay in the thread.
+func pruneTombstones(node *returnValueThreadChirp) bool {
+	replies := []*returnValueThreadChirp{}
+	for _, reply := range node.Replies {
+		if pruneTombstones(reply) {
+			replies = append(replies, reply)
+		}
+	}
+	node.Replies = replies
+	return !node.Deleted || len(node.Replies) > 0
+}
+
+func threadChirpReturnValue(row database.GetChirpThreadRow) *returnValueThreadChirp {
+	chirp := database.Chirp{
+		ID: row.ID,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		Body: row.Body,
+		UserID: row.UserID,
+		InReplyTo: row.InReplyTo,
+		DeletedAt: row.DeletedAt,
+	}
+	return &returnValueThreadChirp{
+		returnValueChirps: chirpReturnValue(chirp, 0),
+		Depth: int(row.Depth),
+		Deleted: row.DeletedAt.Valid,
+		Replies: []*returnValueThreadChirp{},
+	}
+}
+
+// handlerGetChirpThread returns the whole conversation a chirp belongs to,
+// starting from the chirp that began it. Replies are ordered oldest first and
+// deleted chirps show up as tombstones while they still have replies.
+func (cfg *apiConfig) handlerGetChirpThread(resWriter http.ResponseWriter, req *http.Request) {
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error parsing id from request", err)
+		return
+	}
+
+	rows, err := cfg.db.GetChirpThread(req.Context(), chirpID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error getting thread", err)
+		return
+	}
+
+	// Rows come ordered by depth, so every parent is seen before its replies.
+	var root *returnValueThreadChirp
+	nodes := map[uuid.UUID]*returnValueThreadChirp{}
+	for _, row := range rows {
+		node := threadChirpReturnValue(row)
+		nodes[row.ID] = node
+		if row.Depth == 0 {
+			root = node
+			continue
+		}
+		parent, ok := nodes[row.InReplyTo.UUID]
+		if !ok {
+			continue
+		}
+		parent.Replies = append(parent.Replies, node)
+		if !node.Deleted {
+			parent.ReplyCount++
+		}
+	}
+
+	// A deleted chirp can only be reached while it still has live replies.
+	requested, ok := nodes[chirpID]
+	if root == nil || !ok || !pruneTombstones(root) || (requested.Deleted && len(requested.Replies) == 0) {
+		respondWithError(resWriter, http.StatusNotFound, "chirp not found", nil)
+		return
+	}
+
+	// Nodes that were pruned away are still in the map but no longer shown.
+	liveChirps := []*returnValueChirps{}
+	for _, node := range nodes {
+		if !node.Deleted {
+			liveChirps = append(liveChirps, &node.returnValueChirps)
+		}
+	}
+	if err := cfg.countLikes(req.Context(), requestUserID(req), liveChirps); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error counting likes", err)
+		return
+	}
+
+	respondWithJSON(resWriter, http.StatusOK, root)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,9 +23,17 @@ var badWords = map[string]struct{}{
 }
 
 var ErrBodyLengthTooLong = errors.New("body length is too long")
+var ErrReplyToMissingChirp = errors.New("chirp being replied to does not exist")
+var ErrInvalidPageSize = fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+
+const (
+	defaultPageSize = 20
+	maxPageSize = 100
+)
 
 type parametersChirps struct {
 	Body string `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
 }
 type returnValueChirps struct {
 	Id uuid.UUID `json:"id"`
@@ -31,6 +41,72 @@ type returnValueChirps struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body string `json:"body"`
 	UserID uuid.UUID `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	ReplyCount int64 `json:"reply_count"`
+	LikeCount int64 `json:"like_count"`
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+}
+
+type returnValueChirpsPage struct {
+	Chirps []returnValueChirps `json:"chirps"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func chirpReturnValue(chirp database.Chirp, replyCount int64) returnValueChirps {
+	resVal := returnValueChirps{
+		Id: chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body: chirp.Body,
+		UserID: chirp.UserID,
+		ReplyCount: replyCount,
+	}
+	if chirp.InReplyTo.Valid {
+		resVal.InReplyTo = &chirp.InReplyTo.UUID
+	}
+	return resVal
+}
+
+// chirpReturnValues looks up the reply and like counts of every chirp in one
+// query each. Chirps are marked as liked or not when viewerID is a user.
+func (cfg *apiConfig) chirpReturnValues(ctx context.Context, viewerID uuid.UUID, chirps []database.Chirp) ([]returnValueChirps, error) {
+	resVals := make([]returnValueChirps, 0, len(chirps))
+	resValPtrs := make([]*returnValueChirps, 0, len(chirps))
+	for _, chirp := range chirps {
+		resVals = append(resVals, chirpReturnValue(chirp, 0))
+	}
+	for i := range resVals {
+		resValPtrs = append(resValPtrs, &resVals[i])
+	}
+	if err := cfg.countReplies(ctx, resValPtrs); err != nil {
+		return nil, err
+	}
+	if err := cfg.countLikes(ctx, viewerID, resValPtrs); err != nil {
+		return nil, err
+	}
+	return resVals, nil
+}
+
+func (cfg *apiConfig) countReplies(ctx context.Context, resVals []*returnValueChirps) error {
+	if len(resVals) == 0 {
+		return nil
+	}
+	chirpIDs := make([]uuid.UUID, 0, len(resVals))
+	for _, resVal := range resVals {
+		chirpIDs = append(chirpIDs, resVal.Id)
+	}
+	counts, err := cfg.db.CountRepliesByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+	replyCounts := map[uuid.UUID]int64{}
+	for _, count := range counts {
+		replyCounts[count.InReplyTo.UUID] = count.ReplyCount
+	}
+	for _, resVal := range resVals {
+		resVal.ReplyCount = replyCounts[resVal.Id]
+	}
+	return nil
 }
 
 func profanityFilter(msg string) string {
@@ -62,15 +138,18 @@ func (cfg *apiConfig) handlerCreateChirp(resWriter http.ResponseWriter, req *htt
 		return
 	}
 
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "error getting authorization header", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secretKey)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "error validating access token", err)
-		return
+	userID := requestUserID(req)
+
+	if cfg.config.RequireVerifiedEmail {
+		user, err := cfg.db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+			return
+		}
+		if !user.EmailVerifiedAt.Valid {
+			respondWithError(resWriter, http.StatusForbidden, "email address must be verified before posting chirps", ErrEmailNotVerified)
+			return
+		}
 	}
 
 	cleanedMessage, err := validateChirp(params.Body)
@@ -83,69 +162,132 @@ func (cfg *apiConfig) handlerCreateChirp(resWriter http.ResponseWriter, req *htt
 		Body: cleanedMessage,
 		UserID: userID,
 	}
+	// Deleted chirps can not be replied to, but their tombstones would
+	// satisfy the foreign key, so they are looked up first.
+	if params.InReplyTo != nil {
+		_, err := cfg.db.GetChirp(req.Context(), *params.InReplyTo)
+		if err == sql.ErrNoRows {
+			respondWithError(resWriter, http.StatusBadRequest, ErrReplyToMissingChirp.Error(), err)
+			return
+		} else if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error getting chirp being replied to", err)
+			return
+		}
+		chirpParams.InReplyTo = uuid.NullUUID{UUID: *params.InReplyTo, Valid: true}
+	}
 	chirp, err := cfg.db.CreateChirp(req.Context(), chirpParams)
 	if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error creating chirp", err)
 		return
 	}
+	cfg.metrics.chirpsCreated.Inc()
 
-	resVal := returnValueChirps{
-		Id: chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body: chirp.Body,
-		UserID: chirp.UserID,
-	}
+	resVal := chirpReturnValue(chirp, 0)
+	likedByMe := false
+	resVal.LikedByMe = &likedByMe
 	respondWithJSON(resWriter, http.StatusCreated, resVal)
 }
 
 func (cfg *apiConfig) handlerGetChirps(resWriter http.ResponseWriter, req *http.Request) {
 	var chirps []database.Chirp
 	var err error
+	query := req.URL.Query()
 
-	authorID := uuid.Nil
-	authorIDString := req.URL.Query().Get("author_id")
+	authorID := uuid.NullUUID{}
+	authorIDString := query.Get("author_id")
 	if authorIDString != "" {
-		authorID, err = uuid.Parse(authorIDString)
+		authorID.UUID, err = uuid.Parse(authorIDString)
 		if err != nil {
 			respondWithError(resWriter, http.StatusBadRequest, "invalid author ID", err)
 			return
 		}
+		authorID.Valid = true
 	}
 	sortBy := "asc"
-	if req.URL.Query().Get("sort") == "desc" {
+	if query.Get("sort") == "desc" {
 		sortBy = "desc"
 	}
 
-	chirps, err = cfg.db.GetChirps(req.Context())
+	// Clients that send neither limit nor cursor get every chirp as a plain
+	// array, the way this endpoint has always behaved.
+	paginated := query.Has("limit") || query.Has("cursor")
+	limit := sql.NullInt32{}
+	if paginated {
+		pageSize, err := parsePageSize(query.Get("limit"))
+		if err != nil {
+			respondWithError(resWriter, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		// Fetch one extra row to find out whether there is a next page.
+		limit = sql.NullInt32{Int32: int32(pageSize + 1), Valid: true}
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(resWriter, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	if sortBy == "desc" {
+		chirps, err = cfg.db.ListChirpsDesc(req.Context(), database.ListChirpsDescParams{
+			AuthorID: authorID,
+			BeforeCreatedAt: cursorCreatedAt,
+			BeforeID: cursorID,
+			Limit: limit,
+		})
+	} else {
+		chirps, err = cfg.db.ListChirpsAsc(req.Context(), database.ListChirpsAscParams{
+			AuthorID: authorID,
+			AfterCreatedAt: cursorCreatedAt,
+			AfterID: cursorID,
+			Limit: limit,
+		})
+	}
 	if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error getting chirps", err)
 		return
 	}
 
-	resVals := []returnValueChirps{}
-	for _, chirp := range chirps {
-		if authorID != uuid.Nil && chirp.UserID != authorID {
-			continue
-		} 
-
-		resVals = append(resVals, returnValueChirps{
-			Id: chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body: chirp.Body,
-			UserID: chirp.UserID,
-		})
+	var nextCursor *string
+	if limit.Valid && len(chirps) == int(limit.Int32) {
+		chirps = chirps[:len(chirps)-1]
+		last := chirps[len(chirps)-1]
+		encoded := encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		nextCursor = &encoded
 	}
 
-	sort.Slice(resVals, func(i, j int) bool {
-		if sortBy == "desc" {
-			return resVals[i].CreatedAt.After(resVals[j].CreatedAt)
-		}
-		return resVals[i].CreatedAt.Before(resVals[j].CreatedAt)
+	resVals, err := cfg.chirpReturnValues(req.Context(), requestUserID(req), chirps)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error counting replies and likes", err)
+		return
+	}
+
+	if !paginated {
+		respondWithJSON(resWriter, http.StatusOK, resVals)
+		return
+	}
+	respondWithJSON(resWriter, http.StatusOK, returnValueChirpsPage{
+		Chirps: resVals,
+		NextCursor: nextCursor,
 	})
+}
 
-	respondWithJSON(resWriter, http.StatusOK, resVals)
+// parsePageSize reads the limit query parameter, defaulting when it is empty.
+func parsePageSize(limitString string) (int, error) {
+	if limitString == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(limitString)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, ErrInvalidPageSize
+	}
+	return limit, nil
 }
 
 func (cfg *apiConfig) handlerGetChirpsFromID(resWriter http.ResponseWriter, req *http.Request) {
@@ -164,28 +306,16 @@ func (cfg *apiConfig) handlerGetChirpsFromID(resWriter http.ResponseWriter, req
 		return
 	}
 
-	resVal := returnValueChirps{
-		Id: chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body: chirp.Body,
-		UserID: chirp.UserID,
-	}
-	respondWithJSON(resWriter, http.StatusOK, resVal)
-}
-
-func (cfg *apiConfig) handlerDeleteChirpByID(resWriter http.ResponseWriter, req *http.Request) {
-	bearerToken, err := auth.GetBearerToken(req.Header)
+	resVals, err := cfg.chirpReturnValues(req.Context(), requestUserID(req), []database.Chirp{chirp})
 	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "error getting authorization header", err)
+		respondWithError(resWriter, http.StatusInternalServerError, "error counting replies and likes", err)
 		return
 	}
+	respondWithJSON(resWriter, http.StatusOK, resVals[0])
+}
 
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secretKey)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "error validating access token", err)
-		return
-	}
+func (cfg *apiConfig) handlerDeleteChirpByID(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
 
 	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
@@ -202,7 +332,10 @@ func (cfg *apiConfig) handlerDeleteChirpByID(resWriter http.ResponseWriter, req
 		return
 	}
 
-	if chirp.UserID != userID {
+	// Moderators may take down anyone's chirps. Replies to a deleted chirp
+	// stay up.
+	principal, _ := principalFromContext(req.Context())
+	if chirp.UserID != userID && !principal.HasRole(auth.RoleModerator) {
 		respondWithError(resWriter, http.StatusForbidden, "cannot delete content of different author", err)
 		return
 	}
@@ -213,12 +346,5 @@ func (cfg *apiConfig) handlerDeleteChirpByID(resWriter http.ResponseWriter, req
 		return
 	}
 
-	resVals := returnValueChirps{
-		Id: deletedChirp.ID,
-		CreatedAt: deletedChirp.CreatedAt,
-		UpdatedAt: deletedChirp.UpdatedAt,
-		Body: deletedChirp.Body,
-		UserID: deletedChirp.UserID,
-	}
-	respondWithJSON(resWriter, http.StatusNoContent, resVals)
+	respondWithJSON(resWriter, http.StatusNoContent, chirpReturnValue(deletedChirp, 0))
 }
\ No newline at end of file
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/ansht2000/atServer/internal/mailer"
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+var ErrEmailNotVerified = errors.New("email address must be verified first")
+
+type parametersVerifyEmail struct {
+	Token string `json:"token"`
+}
+
+// validateEmail accepts a bare address like "walt@example.com", without a
+// display name or angle brackets.
+func validateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// sendEmailVerification mails user a link that proves they own their current
+// email address.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, user database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().UTC().Add(cfg.config.EmailVerificationTTL)
+	_, err = cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID: user.ID,
+		Email: user.Email,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := cfg.config.PublicURL + "/app/verify-email?token=" + url.QueryEscape(token)
+	return cfg.mailer.Send(ctx, mailer.Message{
+		From: cfg.config.MailFrom,
+		To: user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\nUse this link before %s to verify your email address:\n%s\n", expiresAt.Format(time.RFC1123), link),
+	})
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(resWriter http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersVerifyEmail{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding verify email request data", err)
+		return
+	}
+
+	verificationToken, err := cfg.db.ConsumeEmailVerificationToken(req.Context(), database.ConsumeEmailVerificationTokenParams{
+		Now: time.Now().UTC(),
+		TokenHash: auth.HashToken(params.Token),
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid or expired verification token", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking verification token", err)
+		return
+	}
+	setRequestUserID(resWriter, verificationToken.UserID)
+
+	// The token only verifies the address it was sent to, so it is useless
+	// once the user has changed their email again.
+	user, err := cfg.db.VerifyUserEmail(req.Context(), database.VerifyUserEmailParams{
+		ID: verificationToken.UserID,
+		Email: verificationToken.Email,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid or expired verification token", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error verifying email", err)
+		return
+	}
+
+	resVal := returnValueUsers{
+		Id: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		IsEmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVal)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrRelationToSelf = errors.New("cannot follow, block or mute yourself")
+var ErrFollowBlocked = errors.New("cannot follow a user you blocked or who blocked you")
+
+type returnValueFollow struct {
+	UserID uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type returnValueFollowList struct {
+	Count int `json:"count"`
+	Users []returnValueFollow `json:"users"`
+}
+
+// pathUserID reads the user a route is about and checks that they exist.
+func (cfg *apiConfig) pathUserID(resWriter http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid user ID", err)
+		return uuid.Nil, false
+	}
+	if _, err := cfg.db.GetUserByID(req.Context(), userID); err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return uuid.Nil, false
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// otherUserID is pathUserID for follows, blocks and mutes, which the caller
+// can not have with themselves.
+func (cfg *apiConfig) otherUserID(resWriter http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	otherID, ok := cfg.pathUserID(resWriter, req)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if otherID == requestUserID(req) {
+		respondWithError(resWriter, http.StatusBadRequest, ErrRelationToSelf.Error(), ErrRelationToSelf)
+		return uuid.Nil, false
+	}
+	return otherID, true
+}
+
+func (cfg *apiConfig) handlerFollowUser(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
+	followeeID, ok := cfg.otherUserID(resWriter, req)
+	if !ok {
+		return
+	}
+
+	blocked, err := cfg.db.IsBlockedBetween(req.Context(), database.IsBlockedBetweenParams{
+		UserID: userID,
+		OtherUserID: followeeID,
+	})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking blocks", err)
+		return
+	}
+	if blocked {
+		respondWithError(resWriter, http.StatusForbidden, ErrFollowBlocked.Error(), ErrFollowBlocked)
+		return
+	}
+
+	if err := cfg.db.FollowUser(req.Context(), database.FollowUserParams{FollowerID: userID, FolloweeID: followeeID}); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error following user", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(resWriter http.ResponseWriter, req *http.Request) {
+	followeeID, ok := cfg.otherUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	if err := cfg.db.UnfollowUser(req.Context(), database.UnfollowUserParams{FollowerID: requestUserID(req), FolloweeID: followeeID}); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error unfollowing user", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+// handlerBlockUser blocks a user, which also ends any follow between the two.
+func (cfg *apiConfig) handlerBlockUser(resWriter http.ResponseWriter, req *http.Request) {
+	blockedID, ok := cfg.otherUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	if err := cfg.db.BlockUser(req.Context(), database.BlockUserParams{BlockerID: requestUserID(req), BlockedID: blockedID}); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error blocking user", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnblockUser(resWriter http.ResponseWriter, req *http.Request) {
+	blockedID, ok := cfg.otherUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	if err := cfg.db.UnblockUser(req.Context(), database.UnblockUserParams{BlockerID: requestUserID(req), BlockedID: blockedID}); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error unblocking user", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+// handlerMuteUser hides a user's chirps from the caller's timeline without
+// unfollowing them.
+func (cfg *apiConfig) handlerMuteUser(resWriter http.ResponseWriter, req *http.Request) {
+	mutedID, ok := cfg.otherUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	if err := cfg.db.MuteUser(req.Context(), database.MuteUserParams{MuterID: requestUserID(req), MutedID: mutedID}); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error muting user", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(resWriter http.ResponseWriter, req *http.Request) {
+	mutedID, ok := cfg.otherUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	if err := cfg.db.UnmuteUser(req.Context(), database.UnmuteUserParams{MuterID: requestUserID(req), MutedID: mutedID}); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error unmuting user", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetFollowers(resWriter http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.pathUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	followers, err := cfg.db.ListFollowers(req.Context(), userID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error getting followers", err)
+		return
+	}
+
+	resVal := returnValueFollowList{Count: len(followers), Users: []returnValueFollow{}}
+	for _, follower := range followers {
+		resVal.Users = append(resVal.Users, returnValueFollow{UserID: follower.UserID, FollowedAt: follower.CreatedAt})
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVal)
+}
+
+func (cfg *apiConfig) handlerGetFollowing(resWriter http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.pathUserID(resWriter, req)
+	if !ok {
+		return
+	}
+	following, err := cfg.db.ListFollowing(req.Context(), userID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error getting followed users", err)
+		return
+	}
+
+	resVal := returnValueFollowList{Count: len(following), Users: []returnValueFollow{}}
+	for _, followee := range following {
+		resVal.Users = append(resVal.Users, returnValueFollow{UserID: followee.UserID, FollowedAt: followee.CreatedAt})
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVal)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/config"
+)
+
+// loadKeyring reads the token signing keys from JWT_KEYS_DIR. Without one,
+// which Validate only allows on the dev platform, a key is generated and
+// tokens stop working when the server restarts.
+func loadKeyring(conf config.Config) (*auth.Keyring, error) {
+	var keys []auth.Key
+	if conf.JWTKeysDir == "" {
+		key, err := auth.GenerateKey("dev")
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	} else {
+		loaded, err := auth.LoadKeys(conf.JWTKeysDir)
+		if err != nil {
+			return nil, err
+		}
+		keys = loaded
+	}
+	return auth.NewKeyring(conf.JWTSigningKeyID, keys, conf.Secret.Value())
+}
+
+func (cfg *apiConfig) handlerJWKS(resWriter http.ResponseWriter, req *http.Request) {
+	// Verifiers may cache the set, so a new key should be added a little
+	// before it starts signing.
+	resWriter.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(resWriter, http.StatusOK, cfg.keyring.JWKS())
+}
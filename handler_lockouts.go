@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerUnlockUser lifts an account lockout before it expires.
+func (cfg *apiConfig) handlerUnlockUser(resWriter http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	if _, err := cfg.db.GetUserByID(req.Context(), userID); err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+
+	key := accountThrottleKey(userID)
+	throttle, err := cfg.db.GetLoginThrottle(req.Context(), key)
+	if err == sql.ErrNoRows {
+		resWriter.WriteHeader(http.StatusNoContent)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking login attempts", err)
+		return
+	}
+	if _, err := cfg.db.DeleteLoginThrottle(req.Context(), key); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error unlocking user", err)
+		return
+	}
+	err = cfg.db.CreateLoginLockoutEvent(req.Context(), database.CreateLoginLockoutEventParams{
+		ThrottleKey: key,
+		UserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Event: lockoutEventUnlocked,
+		FailedAttempts: throttle.FailedAttempts,
+	})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error recording unlock", err)
+		return
+	}
+	requestLogger(resWriter).Info("unlocked user", "unlocked_user_id", userID)
+	resWriter.WriteHeader(http.StatusNoContent)
+}
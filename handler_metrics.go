@@ -3,18 +3,109 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/metrics"
 )
 
+type apiMetrics struct {
+	registry *metrics.Registry
+	fileserverHits *metrics.Counter
+	requests *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	requestsInFlight *metrics.Gauge
+	errorResponses *metrics.CounterVec
+	logins *metrics.Counter
+	failedLogins *metrics.Counter
+	loginLockouts *metrics.CounterVec
+	chirpsCreated *metrics.Counter
+	webhooksProcessed *metrics.CounterVec
+}
+
+func newAPIMetrics() *apiMetrics {
+	registry := metrics.NewRegistry()
+	return &apiMetrics{
+		registry: registry,
+		fileserverHits: registry.NewCounter("chirpy_fileserver_hits_total", "Requests served from /app."),
+		requests: registry.NewCounterVec("chirpy_http_requests_total", "HTTP requests by route and status code.", "method", "route", "status"),
+		requestDuration: registry.NewHistogramVec("chirpy_http_request_duration_seconds", "Time taken to serve HTTP requests.", metrics.DefaultBuckets, "method", "route"),
+		requestsInFlight: registry.NewGauge("chirpy_http_requests_in_flight", "HTTP requests currently being served."),
+		errorResponses: registry.NewCounterVec("chirpy_http_error_responses_total", "Responses with a 4XX or 5XX status code.", "route", "status"),
+		logins: registry.NewCounter("chirpy_logins_total", "Successful logins."),
+		failedLogins: registry.NewCounter("chirpy_failed_logins_total", "Login attempts rejected for a wrong email or password."),
+		loginLockouts: registry.NewCounterVec("chirpy_login_lockouts_total", "Accounts or client IPs locked after repeated failed logins.", "kind"),
+		chirpsCreated: registry.NewCounter("chirpy_chirps_created_total", "Chirps created."),
+		webhooksProcessed: registry.NewCounterVec("chirpy_webhooks_processed_total", "Polka webhooks by event and what was done with them.", "event", "result"),
+	}
+}
+
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(resWriter http.ResponseWriter, req *http.Request) {
-		cfg.fileserverHits.Add(1)
+		cfg.metrics.fileserverHits.Inc()
 		next.ServeHTTP(resWriter, req)
 	})
 }
 
+// methodLabel keeps the method label to the standard methods, so clients
+// cannot create a time series per method they make up.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// middlewareMetrics records request counts and latencies per route. The route
+// is the pattern the ServeMux sets on the request it serves, so it only
+// reaches this middleware if everything in between passes the same request
+// on, or copies Pattern back after passing on a copy, the way
+// middlewareAuthenticate does. middlewareRateLimit sets it itself for
+// requests that never reach the mux.
+func (cfg *apiConfig) middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resWriter http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		cfg.metrics.requestsInFlight.Inc()
+		defer cfg.metrics.requestsInFlight.Dec()
+
+		rec := findRecorder(resWriter)
+		if rec == nil {
+			rec = &responseRecorder{ResponseWriter: resWriter, logger: requestLogger(resWriter)}
+			resWriter = rec
+		}
+		next.ServeHTTP(resWriter, req)
+
+		// Unmatched paths share one label so scanners cannot create a
+		// time series per path they try.
+		route := req.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		statusLabel := strconv.Itoa(status)
+		method := methodLabel(req.Method)
+		cfg.metrics.requests.With(method, route, statusLabel).Inc()
+		cfg.metrics.requestDuration.With(method, route).Observe(time.Since(start).Seconds())
+		if status > 399 {
+			cfg.metrics.errorResponses.With(route, statusLabel).Inc()
+		}
+	})
+}
+
 func (cfg *apiConfig) handlerMetrics(resWriter http.ResponseWriter, req *http.Request) {
-	htmlRes := fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", cfg.fileserverHits.Load())
+	htmlRes := fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", int64(cfg.metrics.fileserverHits.Value()))
 	resWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
 	resWriter.WriteHeader(200)
 	resWriter.Write([]byte(htmlRes))
-}
\ No newline at end of file
+}
+
+func (cfg *apiConfig) handlerPrometheusMetrics(resWriter http.ResponseWriter, req *http.Request) {
+	resWriter.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	resWriter.WriteHeader(http.StatusOK)
+	cfg.metrics.registry.WriteText(resWriter)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/ansht2000/atServer/internal/mailer"
+)
+
+var ErrEmptyPassword = errors.New("password cannot be empty")
+
+type parametersForgotPassword struct {
+	Email string `json:"email"`
+}
+
+type parametersResetPassword struct {
+	Token string `json:"token"`
+	Password string `json:"password"`
+}
+
+// handlerForgotPassword emails a reset link. It responds the same way whether
+// or not the email belongs to an account.
+func (cfg *apiConfig) handlerForgotPassword(resWriter http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersForgotPassword{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding forgot password request data", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserFromEmail(req.Context(), params.Email)
+	if err == sql.ErrNoRows {
+		resWriter.WriteHeader(http.StatusAccepted)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error creating reset token", err)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(cfg.config.PasswordResetTTL)
+	_, err = cfg.db.CreatePasswordResetToken(req.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID: user.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error creating reset token", err)
+		return
+	}
+
+	link := cfg.config.PublicURL + "/app/reset-password?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		From: cfg.config.MailFrom,
+		To: user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\nUse this link before %s to choose a new one:\n%s\n\nIf this wasn't you, you can ignore this email.\n", expiresAt.Format(time.RFC1123), link),
+	}
+	// A failed delivery must not change the response, or it would confirm
+	// that the account exists.
+	if err := cfg.mailer.Send(req.Context(), msg); err != nil {
+		requestLogger(resWriter).Error("could not send password reset email", "error", err)
+	}
+	resWriter.WriteHeader(http.StatusAccepted)
+}
+
+// handlerResetPassword uses up a reset token, sets the new password and signs
+// the user out everywhere.
+func (cfg *apiConfig) handlerResetPassword(resWriter http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersResetPassword{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding reset password request data", err)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(resWriter, http.StatusBadRequest, ErrEmptyPassword.Error(), ErrEmptyPassword)
+		return
+	}
+
+	resetToken, err := cfg.db.ConsumePasswordResetToken(req.Context(), database.ConsumePasswordResetTokenParams{
+		Now: time.Now().UTC(),
+		TokenHash: auth.HashToken(params.Token),
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid or expired reset token", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking reset token", err)
+		return
+	}
+	setRequestUserID(resWriter, resetToken.UserID)
+
+	hashedPass, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error creating password hash", err)
+		return
+	}
+	err = cfg.db.UpdateUserPasswordByID(req.Context(), database.UpdateUserPasswordByIDParams{
+		ID: resetToken.UserID,
+		HashedPassword: hashedPass,
+	})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error updating password", err)
+		return
+	}
+	if err := cfg.signOutEverywhere(req.Context(), resetToken.UserID); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking tokens", err)
+		return
+	}
+	// Any other links that were sent are no longer needed.
+	if err := cfg.db.DeletePasswordResetTokensByUserID(req.Context(), resetToken.UserID); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error deleting reset tokens", err)
+		return
+	}
+	// Proving control of the email is enough to lift a lockout too.
+	if _, err := cfg.db.DeleteLoginThrottle(req.Context(), accountThrottleKey(resetToken.UserID)); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error resetting login attempts", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
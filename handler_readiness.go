@@ -1,9 +1,128 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
 
-func handlerReadiness(resWriter http.ResponseWriter, req *http.Request) {
+var ErrDraining = errors.New("server is shutting down")
+var ErrDatabaseUnreachable = errors.New("could not reach the database")
+
+const (
+	readinessStatusOK = "ok"
+	readinessStatusFailed = "failed"
+)
+
+// readinessCheck is one dependency that must be healthy before the instance
+// should receive traffic.
+type readinessCheck struct {
+	name string
+	check func(ctx context.Context) error
+}
+
+type returnValueReadinessCheck struct {
+	Name string `json:"name"`
+	Status string `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error string `json:"error,omitempty"`
+}
+
+type returnValueReadiness struct {
+	Status string `json:"status"`
+	Checks []returnValueReadinessCheck `json:"checks"`
+}
+
+// handlerLiveness only reports that the process is serving requests.
+func handlerLiveness(resWriter http.ResponseWriter, req *http.Request) {
 	resWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	resWriter.WriteHeader(200)
 	resWriter.Write([]byte("OK"))
-}
\ No newline at end of file
+}
+
+// databaseReadinessChecks ping the database and make sure every migration
+// embedded in this binary has been applied.
+func databaseReadinessChecks(db *sql.DB) ([]readinessCheck, error) {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	return []readinessCheck{
+		{
+			name: "database",
+			check: func(ctx context.Context) error {
+				if err := db.PingContext(ctx); err != nil {
+					loggerFromContext(ctx).Warn("database ping failed", "error", err)
+					return ErrDatabaseUnreachable
+				}
+				return nil
+			},
+		},
+		{
+			name: "migrations",
+			check: func(ctx context.Context) error {
+				version, err := migrator.Version(ctx)
+				if err != nil {
+					loggerFromContext(ctx).Warn("could not read migration version", "error", err)
+					return ErrDatabaseUnreachable
+				}
+				if version != migrator.Latest() {
+					return fmt.Errorf("database is at version %d, expected %d", version, migrator.Latest())
+				}
+				return nil
+			},
+		},
+	}, nil
+}
+
+// handlerReadiness runs every check concurrently and responds with 503 when
+// any of them fails, including while the server is draining.
+func (cfg *apiConfig) handlerReadiness(resWriter http.ResponseWriter, req *http.Request) {
+	checks := append([]readinessCheck{{
+		name: "shutdown",
+		check: func(ctx context.Context) error {
+			if cfg.draining.Load() {
+				return ErrDraining
+			}
+			return nil
+		},
+	}}, cfg.readinessChecks...)
+
+	results := make([]returnValueReadinessCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(req.Context(), cfg.config.ReadinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.check(ctx)
+			results[i] = returnValueReadinessCheck{
+				Name: check.name,
+				Status: readinessStatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Status = readinessStatusFailed
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	resVal := returnValueReadiness{Status: readinessStatusOK, Checks: results}
+	code := http.StatusOK
+	for _, result := range results {
+		if result.Status != readinessStatusOK {
+			resVal.Status = readinessStatusFailed
+			code = http.StatusServiceUnavailable
+		}
+	}
+	respondWithJSON(resWriter, code, resVal)
+}
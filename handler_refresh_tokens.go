@@ -7,12 +7,40 @@ import (
 	"time"
 
 	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
 )
 
 var ErrRefreshTokenExpired = errors.New("refresh token has expired")
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
 
 type returnValueRefreshToken struct {
 	Token string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// createRefreshToken issues a new refresh token in the given family. Every
+// login starts a new family and every refresh continues the family of the
+// token it replaces. The family is the session the user sees, labelled with
+// the client that last refreshed it.
+func (cfg *apiConfig) createRefreshToken(req *http.Request, userID, familyID uuid.UUID) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	createRefreshTokenParams := database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID: userID,
+		FamilyID: familyID,
+		UserAgent: req.UserAgent(),
+		IpAddress: cfg.clientIP(req),
+	}
+	_, err = cfg.db.CreateRefreshToken(req.Context(), createRefreshTokenParams)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
 }
 
 func (cfg *apiConfig) handlerRefresh(resWriter http.ResponseWriter, req *http.Request) {
@@ -22,7 +50,7 @@ func (cfg *apiConfig) handlerRefresh(resWriter http.ResponseWriter, req *http.Re
 		return
 	}
 
-	refreshToken, err := cfg.db.GetRefreshToken(req.Context(), userToken)
+	refreshToken, err := cfg.db.GetRefreshToken(req.Context(), auth.HashToken(userToken))
 	if err == sql.ErrNoRows {
 		respondWithError(resWriter, http.StatusUnauthorized, "refresh token does not exist", err)
 		return
@@ -30,13 +58,44 @@ func (cfg *apiConfig) handlerRefresh(resWriter http.ResponseWriter, req *http.Re
 		respondWithError(resWriter, http.StatusInternalServerError, "error encountered while getting refresh token", err)
 		return
 	}
+	setRequestUserID(resWriter, refreshToken.UserID)
 
-	if refreshToken.ExpiresAt.Before(time.Now()) || refreshToken.RevokedAt.Valid  {
+	// A revoked token being presented again means it was copied: either the
+	// client or an attacker is holding a token that has since been rotated.
+	// There is no telling which, so the whole family is revoked.
+	if refreshToken.RevokedAt.Valid {
+		cfg.revokeRefreshTokenFamily(resWriter, req, refreshToken)
+		return
+	}
+	if refreshToken.ExpiresAt.Before(time.Now()) {
 		respondWithError(resWriter, http.StatusUnauthorized, "refresh token has expired", ErrRefreshTokenExpired)
 		return
 	}
 
-	newJWT, err := auth.MakeJWT(refreshToken.UserID, cfg.secretKey, time.Hour)
+	// Consuming only succeeds for one caller, so two requests racing with the
+	// same token are treated like any other reuse.
+	_, err = cfg.db.ConsumeRefreshToken(req.Context(), refreshToken.TokenHash)
+	if err == sql.ErrNoRows {
+		cfg.revokeRefreshTokenFamily(resWriter, req, refreshToken)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error rotating refresh token", err)
+		return
+	}
+
+	// Roles are read again so a change takes effect at the next refresh.
+	user, err := cfg.db.GetUserByID(req.Context(), refreshToken.UserID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+	newRefreshToken, err := cfg.createRefreshToken(req, refreshToken.UserID, refreshToken.FamilyID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error creating refresh token", err)
+		return
+	}
+
+	newJWT, err := cfg.makeAccessToken(user, refreshToken.FamilyID)
 	if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error making authorization token", err)
 		return
@@ -44,10 +103,21 @@ func (cfg *apiConfig) handlerRefresh(resWriter http.ResponseWriter, req *http.Re
 
 	resVal := returnValueRefreshToken{
 		Token: newJWT,
+		RefreshToken: newRefreshToken,
 	}
 	respondWithJSON(resWriter, http.StatusOK, resVal)
 }
 
+func (cfg *apiConfig) revokeRefreshTokenFamily(resWriter http.ResponseWriter, req *http.Request, refreshToken database.RefreshToken) {
+	err := cfg.db.RevokeRefreshTokenFamily(req.Context(), refreshToken.FamilyID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking refresh tokens", err)
+		return
+	}
+	requestLogger(resWriter).Warn("refresh token reuse detected, revoked token family", "family_id", refreshToken.FamilyID)
+	respondWithError(resWriter, http.StatusUnauthorized, "refresh token has been revoked", ErrRefreshTokenReused)
+}
+
 func (cfg *apiConfig) handlerRevoke(resWriter http.ResponseWriter, req *http.Request) {
 	userToken, err := auth.GetBearerToken(req.Header)
 	if err != nil {
@@ -55,7 +125,7 @@ func (cfg *apiConfig) handlerRevoke(resWriter http.ResponseWriter, req *http.Req
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(req.Context(), userToken)
+	err = cfg.db.RevokeRefreshToken(req.Context(), auth.HashToken(userToken))
 	if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "could not revoke refresh token", err)
 	}
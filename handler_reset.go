@@ -2,15 +2,12 @@ package main
 
 import (
 	"net/http"
-	"os"
 )
 
+// handlerReset wipes every user. The route requires the admin role, on every
+// platform.
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
-	if os.Getenv("PLATFORM") != "dev" {
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-	cfg.fileserverHits.Store(0)
+	cfg.metrics.fileserverHits.Reset()
 	cfg.db.DeleteUsers(r.Context())
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0"))
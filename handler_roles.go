@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+type parametersUserRole struct {
+	Role string `json:"role"`
+}
+
+// handlerUpdateUserRole changes the role of a user. Access tokens already
+// issued keep their roles until the user refreshes.
+func (cfg *apiConfig) handlerUpdateUserRole(resWriter http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersUserRole{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding role request data", err)
+		return
+	}
+	if _, err := auth.ImpliedRoles(params.Role); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	user, err := cfg.db.UpdateUserRole(req.Context(), database.UpdateUserRoleParams{ID: userID, Role: params.Role})
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error updating role", err)
+		return
+	}
+	requestLogger(resWriter).Info("changed user role", "changed_user_id", user.ID, "role", user.Role)
+
+	resVal := returnValueUsers{
+		Id: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		IsEmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVal)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+type returnValueSession struct {
+	Id uuid.UUID `json:"id"`
+	UserAgent string `json:"user_agent"`
+	IpAddress string `json:"ip_address"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current marks the session the request itself was made with.
+	Current bool `json:"current"`
+}
+
+func (cfg *apiConfig) handlerGetSessions(resWriter http.ResponseWriter, req *http.Request) {
+	principal, _ := principalFromContext(req.Context())
+	sessions, err := cfg.db.ListSessionsByUserID(req.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving sessions", err)
+		return
+	}
+	resVals := make([]returnValueSession, 0, len(sessions))
+	for _, session := range sessions {
+		resVals = append(resVals, returnValueSession{
+			Id: session.FamilyID,
+			UserAgent: session.UserAgent,
+			IpAddress: session.IpAddress,
+			SignedInAt: session.SignedInAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt: session.ExpiresAt,
+			Current: session.FamilyID == principal.SessionID,
+		})
+	}
+	respondWithJSON(resWriter, http.StatusOK, resVals)
+}
+
+// handlerRevokeSession signs out one session. Access tokens already issued
+// for it stay valid until they expire; /api/logout revokes both.
+func (cfg *apiConfig) handlerRevokeSession(resWriter http.ResponseWriter, req *http.Request) {
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid session id", err)
+		return
+	}
+	revoked, err := cfg.db.RevokeSession(req.Context(), database.RevokeSessionParams{FamilyID: sessionID, UserID: requestUserID(req)})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(resWriter, http.StatusNotFound, "session not found", sql.ErrNoRows)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLogoutAll signs out every session of the caller, the current one
+// included, and revokes every access token they were issued.
+func (cfg *apiConfig) handlerLogoutAll(resWriter http.ResponseWriter, req *http.Request) {
+	if err := cfg.signOutEverywhere(req.Context(), requestUserID(req)); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking sessions", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultSubscriptionPeriod = 30 * 24 * time.Hour
+
+const (
+	subscriptionStatusActive = "active"
+	subscriptionStatusCanceled = "canceled"
+	subscriptionStatusExpired = "expired"
+	subscriptionStatusNone = "none"
+)
+
+type returnValueSubscriptionEvent struct {
+	Event string `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	PeriodStart *time.Time `json:"period_start"`
+	PeriodEnd *time.Time `json:"period_end"`
+}
+
+type returnValueSubscription struct {
+	Status string `json:"status"`
+	IsChirpyRed bool `json:"is_chirpy_red"`
+	CurrentPeriodStart *time.Time `json:"current_period_start"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	History []returnValueSubscriptionEvent `json:"history"`
+}
+
+// subscriptionEventHandlers maps each Polka event this server understands to
+// the change it makes. Any other event is acknowledged and ignored.
+func (cfg *apiConfig) subscriptionEventHandlers() map[string]func(context.Context, parametersWebhook) error {
+	return map[string]func(context.Context, parametersWebhook) error{
+		"user.upgraded": cfg.applyUpgrade,
+		"subscription.renewed": cfg.applyRenewal,
+		"user.downgraded": func(ctx context.Context, params parametersWebhook) error {
+			return cfg.endSubscription(ctx, params.Data.UserID, params.Event, subscriptionStatusCanceled)
+		},
+		"subscription.expired": func(ctx context.Context, params parametersWebhook) error {
+			return cfg.endSubscription(ctx, params.Data.UserID, params.Event, subscriptionStatusExpired)
+		},
+	}
+}
+
+func (cfg *apiConfig) applyUpgrade(ctx context.Context, params parametersWebhook) error {
+	start := time.Now().UTC()
+	if params.Data.PeriodStart != nil {
+		start = *params.Data.PeriodStart
+	}
+	return cfg.startSubscriptionPeriod(ctx, params, start)
+}
+
+// applyRenewal starts the next period where the current one ends, so renewing
+// early does not shorten what was already paid for.
+func (cfg *apiConfig) applyRenewal(ctx context.Context, params parametersWebhook) error {
+	start := time.Now().UTC()
+	subscription, err := cfg.db.GetSubscriptionByUserID(ctx, params.Data.UserID)
+	if err == nil && subscription.Status == subscriptionStatusActive && subscription.CurrentPeriodEnd.After(start) {
+		start = subscription.CurrentPeriodEnd
+	} else if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if params.Data.PeriodStart != nil {
+		start = *params.Data.PeriodStart
+	}
+	return cfg.startSubscriptionPeriod(ctx, params, start)
+}
+
+// startSubscriptionPeriod stores the period in UTC, as the columns keep no
+// time zone and Polka may send times in any.
+func (cfg *apiConfig) startSubscriptionPeriod(ctx context.Context, params parametersWebhook, start time.Time) error {
+	end := start.Add(defaultSubscriptionPeriod)
+	if params.Data.PeriodEnd != nil {
+		end = *params.Data.PeriodEnd
+	}
+	start, end = start.UTC(), end.UTC()
+
+	_, err := cfg.db.UpgradeUserByID(ctx, params.Data.UserID)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.db.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID: params.Data.UserID,
+		Status: subscriptionStatusActive,
+		CurrentPeriodStart: start,
+		CurrentPeriodEnd: end,
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.db.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		UserID: params.Data.UserID,
+		Event: params.Event,
+		PeriodStart: sql.NullTime{Time: start, Valid: true},
+		PeriodEnd: sql.NullTime{Time: end, Valid: true},
+	})
+}
+
+// endSubscription removes Chirpy Red from a user. Users upgraded before
+// subscriptions were tracked have no subscription row, which is not an error.
+func (cfg *apiConfig) endSubscription(ctx context.Context, userID uuid.UUID, event, status string) error {
+	_, err := cfg.db.DowngradeUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.db.UpdateSubscriptionStatus(ctx, database.UpdateSubscriptionStatusParams{
+		UserID: userID,
+		Status: status,
+	})
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return cfg.db.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		UserID: userID,
+		Event: event,
+	})
+}
+
+// sweepExpiredSubscriptions downgrades every user whose paid period has ended
+// without Polka telling us about a renewal or an expiry.
+func (cfg *apiConfig) sweepExpiredSubscriptions(ctx context.Context) error {
+	expired, err := cfg.db.ExpireSubscriptions(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, subscription := range expired {
+		if _, err := cfg.db.DowngradeUserByID(ctx, subscription.UserID); err != nil {
+			return err
+		}
+		err = cfg.db.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+			UserID: subscription.UserID,
+			Event: "subscription.expired",
+			PeriodStart: sql.NullTime{Time: subscription.CurrentPeriodStart, Valid: true},
+			PeriodEnd: sql.NullTime{Time: subscription.CurrentPeriodEnd, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) runSubscriptionSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.sweepExpiredSubscriptions(ctx); err != nil {
+				log.Printf("error sweeping expired subscriptions: %v\n", err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerGetSubscription(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
+
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+
+	resVal := returnValueSubscription{
+		Status: subscriptionStatusNone,
+		IsChirpyRed: user.IsChirpyRed,
+		History: []returnValueSubscriptionEvent{},
+	}
+	if user.IsChirpyRed {
+		resVal.Status = subscriptionStatusActive
+	}
+
+	subscription, err := cfg.db.GetSubscriptionByUserID(req.Context(), userID)
+	if err == nil {
+		resVal.Status = subscription.Status
+		resVal.CurrentPeriodStart = &subscription.CurrentPeriodStart
+		resVal.CurrentPeriodEnd = &subscription.CurrentPeriodEnd
+	} else if err != sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving subscription", err)
+		return
+	}
+
+	events, err := cfg.db.GetSubscriptionEventsByUserID(req.Context(), userID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving subscription history", err)
+		return
+	}
+	for _, event := range events {
+		resVal.History = append(resVal.History, returnValueSubscriptionEvent{
+			Event: event.Event,
+			CreatedAt: event.CreatedAt,
+			PeriodStart: nullTimePtr(event.PeriodStart),
+			PeriodEnd: nullTimePtr(event.PeriodEnd),
+		})
+	}
+
+	respondWithJSON(resWriter, http.StatusOK, resVal)
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
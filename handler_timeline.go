@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerGetTimeline pages through chirps by the users the caller follows,
+// newest first. Chirps by blocked or muted users are left out.
+func (cfg *apiConfig) handlerGetTimeline(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
+	query := req.URL.Query()
+
+	pageSize, err := parsePageSize(query.Get("limit"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			respondWithError(resWriter, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	// Fetch one extra row to find out whether there is a next page.
+	chirps, err := cfg.db.ListTimeline(req.Context(), database.ListTimelineParams{
+		UserID: userID,
+		BeforeCreatedAt: cursorCreatedAt,
+		BeforeID: cursorID,
+		Limit: int32(pageSize + 1),
+	})
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error getting timeline", err)
+		return
+	}
+
+	var nextCursor *string
+	if len(chirps) == pageSize+1 {
+		chirps = chirps[:pageSize]
+		last := chirps[len(chirps)-1]
+		encoded := encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		nextCursor = &encoded
+	}
+
+	resVals, err := cfg.chirpReturnValues(req.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error counting replies and likes", err)
+		return
+	}
+	respondWithJSON(resWriter, http.StatusOK, returnValueChirpsPage{
+		Chirps: resVals,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type parametersTwoFactorCode struct {
+	Code string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type parametersLoginTwoFactor struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type returnValueTwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type returnValueRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type returnValueTwoFactorChallenge struct {
+	TwoFactorRequired bool `json:"two_factor_required"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// twoFactorEnabled reports whether userID has confirmed a TOTP enrollment.
+func (cfg *apiConfig) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	enrollment, err := cfg.db.GetTOTPByUserID(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return enrollment.ConfirmedAt.Valid, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Both are spent by a successful check, so neither works twice.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, enrollment database.UserTotp, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		recoveryCode = auth.NormalizeRecoveryCode(recoveryCode)
+		codes, err := cfg.db.ListUnusedTOTPRecoveryCodesByUserID(ctx, enrollment.UserID)
+		if err != nil {
+			return false, err
+		}
+		for _, code := range codes {
+			if auth.CheckPasswordHash(recoveryCode, code.CodeHash) != nil {
+				continue
+			}
+			rows, err := cfg.db.UseTOTPRecoveryCode(ctx, code.ID)
+			return rows == 1, err
+		}
+		return false, nil
+	}
+
+	step, ok := auth.ValidateTOTP(enrollment.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	rows, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: enrollment.UserID, LastUsedStep: step})
+	return rows == 1, err
+}
+
+func (cfg *apiConfig) handlerEnrollTwoFactor(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
+
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error making two-factor secret", err)
+		return
+	}
+	_, err = cfg.db.UpsertTOTPEnrollment(req.Context(), database.UpsertTOTPEnrollmentParams{UserID: user.ID, Secret: secret})
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusConflict, ErrTwoFactorAlreadyEnabled.Error(), ErrTwoFactorAlreadyEnabled)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error saving two-factor enrollment", err)
+		return
+	}
+
+	respondWithJSON(resWriter, http.StatusOK, returnValueTwoFactorEnrollment{
+		Secret: secret,
+		OTPAuthURI: auth.TOTPURI("Chirpy", user.Email, secret),
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmTwoFactor(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
+
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersTwoFactorCode{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding two-factor request data", err)
+		return
+	}
+
+	enrollment, err := cfg.db.GetTOTPByUserID(req.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "two-factor enrollment has not been started", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving two-factor enrollment", err)
+		return
+	}
+	if enrollment.ConfirmedAt.Valid {
+		respondWithError(resWriter, http.StatusConflict, ErrTwoFactorAlreadyEnabled.Error(), ErrTwoFactorAlreadyEnabled)
+		return
+	}
+	step, ok := auth.ValidateTOTP(enrollment.Secret, params.Code, time.Now())
+	if !ok {
+		respondWithError(resWriter, http.StatusBadRequest, ErrInvalidTwoFactorCode.Error(), ErrInvalidTwoFactorCode)
+		return
+	}
+
+	recoveryCodes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error making recovery codes", err)
+		return
+	}
+	// Codes left over from an earlier enrollment must not keep working.
+	if err := cfg.db.DeleteTOTPRecoveryCodesByUserID(req.Context(), userID); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error saving recovery codes", err)
+		return
+	}
+	for _, code := range recoveryCodes {
+		codeHash, err := auth.HashPassword(code)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error saving recovery codes", err)
+			return
+		}
+		err = cfg.db.CreateTOTPRecoveryCode(req.Context(), database.CreateTOTPRecoveryCodeParams{
+			CodeHash: codeHash,
+			UserID: userID,
+		})
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error saving recovery codes", err)
+			return
+		}
+	}
+
+	// Confirming last means a failure above leaves two-factor off.
+	_, err = cfg.db.ConfirmTOTP(req.Context(), database.ConfirmTOTPParams{UserID: userID, LastUsedStep: step})
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusConflict, ErrTwoFactorAlreadyEnabled.Error(), ErrTwoFactorAlreadyEnabled)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error confirming two-factor enrollment", err)
+		return
+	}
+
+	respondWithJSON(resWriter, http.StatusOK, returnValueRecoveryCodes{RecoveryCodes: recoveryCodes})
+}
+
+func (cfg *apiConfig) handlerDeleteTwoFactor(resWriter http.ResponseWriter, req *http.Request) {
+	userID := requestUserID(req)
+
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersTwoFactorCode{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding two-factor request data", err)
+		return
+	}
+
+	enrollment, err := cfg.db.GetTOTPByUserID(req.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, ErrTwoFactorNotEnabled.Error(), ErrTwoFactorNotEnabled)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving two-factor enrollment", err)
+		return
+	}
+	// An unconfirmed enrollment protects nothing, so it can be dropped
+	// without a code.
+	if enrollment.ConfirmedAt.Valid {
+		ok, err := cfg.checkSecondFactor(req.Context(), enrollment, params.Code, params.RecoveryCode)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error checking two-factor code", err)
+			return
+		}
+		if !ok {
+			respondWithError(resWriter, http.StatusForbidden, ErrInvalidTwoFactorCode.Error(), ErrInvalidTwoFactorCode)
+			return
+		}
+	}
+
+	if err := cfg.db.DeleteTOTP(req.Context(), userID); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error disabling two-factor authentication", err)
+		return
+	}
+	if err := cfg.db.DeleteTOTPRecoveryCodesByUserID(req.Context(), userID); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error disabling two-factor authentication", err)
+		return
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerLoginTwoFactor(resWriter http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	params := parametersLoginTwoFactor{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error decoding two-factor login request data", err)
+		return
+	}
+
+	userID, err := auth.ValidateChallengeJWT(params.ChallengeToken, cfg.keyring)
+	if err != nil {
+		respondWithError(resWriter, http.StatusUnauthorized, "invalid or expired challenge token", err)
+		return
+	}
+	setRequestUserID(resWriter, userID)
+
+	accountKey := accountThrottleKey(userID)
+	locked, err := cfg.loginLocked(req.Context(), accountKey)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking login attempts", err)
+		return
+	}
+	if locked {
+		cfg.metrics.failedLogins.Inc()
+		respondWithError(resWriter, http.StatusUnauthorized, ErrInvalidTwoFactorCode.Error(), ErrAccountLocked)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusUnauthorized, "invalid or expired challenge token", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+	enrollment, err := cfg.db.GetTOTPByUserID(req.Context(), userID)
+	if err == sql.ErrNoRows || (err == nil && !enrollment.ConfirmedAt.Valid) {
+		respondWithError(resWriter, http.StatusUnauthorized, ErrTwoFactorNotEnabled.Error(), ErrTwoFactorNotEnabled)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving two-factor enrollment", err)
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(req.Context(), enrollment, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking two-factor code", err)
+		return
+	}
+	if !ok {
+		cfg.metrics.failedLogins.Inc()
+		// Wrong codes count towards the same lockout as wrong passwords.
+		err := cfg.recordLoginFailure(req.Context(), accountKey, uuid.NullUUID{UUID: userID, Valid: true}, cfg.config.LoginMaxFailures)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error recording failed login", err)
+			return
+		}
+		respondWithError(resWriter, http.StatusUnauthorized, ErrInvalidTwoFactorCode.Error(), ErrInvalidTwoFactorCode)
+		return
+	}
+
+	cfg.respondWithLogin(resWriter, req, user)
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"time"
 
@@ -12,20 +11,11 @@ import (
 	"github.com/google/uuid"
 )
 
-var ErrInvalidAPIKey = errors.New("invalid api key")
-
 type parametersUsers struct {
 	Password string `json:"password"`
 	Email string `json:"email"`
 }
 
-type parametersWebhook struct {
-	Event string `json:"event"`
-	Data struct {
-		UserID uuid.UUID `json:"user_id"`
-	} `json:"data"`
-}
-
 type returnValueUsers struct {
 	Id uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -34,6 +24,8 @@ type returnValueUsers struct {
 	Token string `json:"token"`
 	RefreshToken string `json:"refresh_token"`
 	IsChirpyRed bool `json:"is_chirpy_red"`
+	IsEmailVerified bool `json:"is_email_verified"`
+	Role string `json:"role"`
 }
 
 func (cfg *apiConfig) handlerLoginUser(resWriter http.ResponseWriter, req *http.Request) {
@@ -45,42 +37,119 @@ func (cfg *apiConfig) handlerLoginUser(resWriter http.ResponseWriter, req *http.
 		return
 	}
 
-	user, err := cfg.db.GetUserFromEmail(req.Context(), params.Email)
-	if err == sql.ErrNoRows {
-		respondWithError(resWriter, http.StatusUnauthorized, "incorrect email or password", err)
+	ipKey := ipThrottleKey(cfg.clientIP(req))
+	ipLocked, err := cfg.loginLocked(req.Context(), ipKey)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking login attempts", err)
 		return
-	} else if err != nil {
+	}
+
+	user, err := cfg.db.GetUserFromEmail(req.Context(), params.Email)
+	userFound := err == nil
+	if err != nil && err != sql.ErrNoRows {
 		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "incorrect email or password", err)
+	// The password is always checked, even against a dummy hash, so the
+	// response time does not reveal whether the account exists or is locked.
+	passwordHash := dummyPasswordHash()
+	if userFound {
+		passwordHash = user.HashedPassword
+	}
+	loginErr := auth.CheckPasswordHash(params.Password, passwordHash)
+
+	accountKey := accountThrottleKey(user.ID)
+	accountLocked := false
+	if userFound {
+		accountLocked, err = cfg.loginLocked(req.Context(), accountKey)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error checking login attempts", err)
+			return
+		}
+	}
+
+	switch {
+	case ipLocked:
+		loginErr = ErrClientLocked
+	case !userFound:
+		loginErr = sql.ErrNoRows
+	case accountLocked:
+		loginErr = ErrAccountLocked
+	}
+	if loginErr != nil {
+		cfg.metrics.failedLogins.Inc()
+		// Attempts made while locked do not extend the lockout.
+		if !ipLocked {
+			err = cfg.recordLoginFailure(req.Context(), ipKey, uuid.NullUUID{}, cfg.config.LoginMaxFailuresPerIP)
+		}
+		if err == nil && userFound && !accountLocked {
+			err = cfg.recordLoginFailure(req.Context(), accountKey, uuid.NullUUID{UUID: user.ID, Valid: true}, cfg.config.LoginMaxFailures)
+		}
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error recording failed login", err)
+			return
+		}
+		respondWithError(resWriter, http.StatusUnauthorized, "incorrect email or password", loginErr)
 		return
 	}
 
-	tokString, err := auth.MakeJWT(user.ID, cfg.secretKey, time.Hour)
+	twoFactor, err := cfg.twoFactorEnabled(req.Context(), user.ID)
 	if err != nil {
-		respondWithError(resWriter, http.StatusInternalServerError, "error making authorization token", err)
+		respondWithError(resWriter, http.StatusInternalServerError, "error checking two-factor authentication", err)
+		return
+	}
+	if twoFactor {
+		// Failed attempts are only cleared once the second factor passes.
+		setRequestUserID(resWriter, user.ID)
+		challengeToken, err := auth.MakeChallengeJWT(user.ID, cfg.keyring, twoFactorChallengeTTL)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error making challenge token", err)
+			return
+		}
+		respondWithJSON(resWriter, http.StatusOK, returnValueTwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken: challengeToken,
+		})
 		return
 	}
-	refreshToken, err := auth.MakeRefreshToken()
+	cfg.respondWithLogin(resWriter, req, user)
+}
+
+// makeAccessToken issues an hour long access token for a session of user,
+// carrying their roles and the scopes every login gets.
+func (cfg *apiConfig) makeAccessToken(user database.User, sessionID uuid.UUID) (string, error) {
+	roles, err := auth.ImpliedRoles(user.Role)
 	if err != nil {
-		respondWithError(resWriter, http.StatusInternalServerError, "error making refresh token", err)
+		return "", err
+	}
+	principal := auth.Principal{UserID: user.ID, SessionID: sessionID, Roles: roles, Scopes: auth.DefaultScopes}
+	return auth.MakeJWT(principal, cfg.keyring, time.Hour)
+}
+
+// respondWithLogin finishes a successful login by issuing an access and
+// refresh token pair for user.
+func (cfg *apiConfig) respondWithLogin(resWriter http.ResponseWriter, req *http.Request, user database.User) {
+	accountKey := accountThrottleKey(user.ID)
+	if _, err := cfg.db.DeleteLoginThrottle(req.Context(), accountKey); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error resetting login attempts", err)
 		return
 	}
+	setRequestUserID(resWriter, user.ID)
 
-	createRefreshTokenParams := database.CreateRefreshTokenParams{
-		Token: refreshToken,
-		UserID: user.ID,
+	sessionID := uuid.New()
+	tokString, err := cfg.makeAccessToken(user, sessionID)
+	if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error making authorization token", err)
+		return
 	}
-	_, err = cfg.db.CreateRefreshToken(req.Context(), createRefreshTokenParams)
+	refreshToken, err := cfg.createRefreshToken(req, user.ID, sessionID)
 	if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error creating refresh token", err)
 		return
 	}
 
+	cfg.metrics.logins.Inc()
 	resVals := returnValueUsers{
 		Id: user.ID,
 		CreatedAt: user.CreatedAt,
@@ -89,6 +158,8 @@ func (cfg *apiConfig) handlerLoginUser(resWriter http.ResponseWriter, req *http.
 		Token: tokString,
 		RefreshToken: refreshToken,
 		IsChirpyRed: user.IsChirpyRed,
+		IsEmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
 	}
 	respondWithJSON(resWriter, http.StatusOK, resVals)
 }
@@ -101,6 +172,10 @@ func (cfg *apiConfig) handlerCreateUser(resWriter http.ResponseWriter, req *http
 		respondWithError(resWriter, http.StatusInternalServerError, "error decoding creating user request data", err)
 		return
 	}
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 
 	hashedPass, err := auth.HashPassword(params.Password)
 	if err != nil {
@@ -114,10 +189,18 @@ func (cfg *apiConfig) handlerCreateUser(resWriter http.ResponseWriter, req *http
 	}
 
 	user, err := cfg.db.CreateUser(req.Context(), createUserParams)
-	if err != nil {
+	if database.IsUniqueViolation(err) {
+		respondWithError(resWriter, http.StatusConflict, "email is already in use", err)
+		return
+	} else if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error creating user", err)
 		return
 	}
+	// The account is created either way; the user can ask for another link
+	// by saving their email again.
+	if err := cfg.sendEmailVerification(req.Context(), user); err != nil {
+		requestLogger(resWriter).Error("could not send verification email", "error", err)
+	}
 
 	resVal := returnValueUsers{
 		Id: user.ID,
@@ -125,30 +208,31 @@ func (cfg *apiConfig) handlerCreateUser(resWriter http.ResponseWriter, req *http
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		IsEmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
 	}
 	respondWithJSON(resWriter, http.StatusCreated, resVal)
 }
 
+// handlerUpdateUser changes the email and password of the caller and signs
+// out every other session, since a password change is often a reaction to
+// someone else having it. Every access token issued so far is revoked, so
+// the caller gets a new one for their own session.
 func (cfg *apiConfig) handlerUpdateUser(resWriter http.ResponseWriter, req *http.Request) {
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "error getting authorization header", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secretKey)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "error validating access token", err)
-		return
-	}
+	principal, _ := principalFromContext(req.Context())
+	userID := principal.UserID
 
 	defer req.Body.Close()
 	params := parametersUsers{}
 	decoder := json.NewDecoder(req.Body)
-	if err = decoder.Decode(&params); err != nil {
+	if err := decoder.Decode(&params); err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error decoding request data", err)
 		return
 	}
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 
 	hashedPass, err := auth.HashPassword(params.Password)
 	if err != nil {
@@ -162,8 +246,36 @@ func (cfg *apiConfig) handlerUpdateUser(resWriter http.ResponseWriter, req *http
 		ID: userID,
 	}
 	user, err := cfg.db.UpdateUserEmailPasswordByID(req.Context(), updateParams)
-	if err != nil {
+	if database.IsUniqueViolation(err) {
+		respondWithError(resWriter, http.StatusConflict, "email is already in use", err)
+		return
+	} else if err != nil {
 		respondWithError(resWriter, http.StatusInternalServerError, "error updating email and password", err)
+		return
+	}
+	// Changing the password with an API key signs out every session.
+	revokeParams := database.RevokeOtherRefreshTokensByUserIDParams{UserID: userID, FamilyID: principal.SessionID}
+	if err := cfg.db.RevokeOtherRefreshTokensByUserID(req.Context(), revokeParams); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error signing out other sessions", err)
+		return
+	}
+	if err := cfg.revokeUserAccessTokens(req.Context(), userID); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking access tokens", err)
+		return
+	}
+	tokString := ""
+	if principal.SessionID != uuid.Nil {
+		tokString, err = cfg.makeAccessToken(user, principal.SessionID)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error making authorization token", err)
+			return
+		}
+	}
+	// Saving an unverified email again sends a fresh link.
+	if !user.EmailVerifiedAt.Valid {
+		if err := cfg.sendEmailVerification(req.Context(), user); err != nil {
+			requestLogger(resWriter).Error("could not send verification email", "error", err)
+		}
 	}
 
 	resVal := returnValueUsers{
@@ -171,44 +283,10 @@ func (cfg *apiConfig) handlerUpdateUser(resWriter http.ResponseWriter, req *http
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		Token: tokString,
 		IsChirpyRed: user.IsChirpyRed,
+		IsEmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
 	}
 	respondWithJSON(resWriter, http.StatusOK, resVal)
 }
-
-func (cfg *apiConfig) handlerUpgradeUser(resWriter http.ResponseWriter, req *http.Request) {
-	apiKey, err := auth.GetAPIKey(req.Header)
-	if err != nil {
-		respondWithError(resWriter, http.StatusUnauthorized, "could not find api key", err)
-		return
-	}
-
-	if apiKey != cfg.apiKey {
-		respondWithError(resWriter, http.StatusUnauthorized, "invalid api key", ErrInvalidAPIKey)
-		return
-	}
-
-	defer req.Body.Close()
-	params := parametersWebhook{}
-	decoder := json.NewDecoder(req.Body)
-	if err := decoder.Decode(&params); err != nil {
-		respondWithError(resWriter, http.StatusInternalServerError, "error decoding request data", err)
-		return
-	}
-
-	if params.Event != "user.upgraded" {
-		resWriter.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	_, err = cfg.db.UpgradeUserByID(req.Context(), params.Data.UserID)
-	if err == sql.ErrNoRows {
-		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
-		return
-	} else if err != nil {
-		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
-		return
-	}
-
-	resWriter.WriteHeader(http.StatusNoContent)
-}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+var ErrWebhookEventIDRequired = errors.New("signed webhook events must have an id")
+
+const maxWebhookBodySize = 1 << 20
+
+type parametersWebhook struct {
+	ID string `json:"id"`
+	Event string `json:"event"`
+	Data struct {
+		UserID uuid.UUID `json:"user_id"`
+		// The billing period is optional; without it a period of
+		// defaultSubscriptionPeriod starting now is assumed.
+		PeriodStart *time.Time `json:"period_start,omitempty"`
+		PeriodEnd *time.Time `json:"period_end,omitempty"`
+	} `json:"data"`
+}
+
+func (cfg *apiConfig) handlerPolkaWebhook(resWriter http.ResponseWriter, req *http.Request) {
+	apiKey, err := auth.GetAPIKey(req.Header)
+	if err != nil {
+		respondWithError(resWriter, http.StatusUnauthorized, "could not find api key", err)
+		return
+	}
+
+	if apiKey != cfg.config.PolkaKey.Value() {
+		respondWithError(resWriter, http.StatusUnauthorized, "invalid api key", ErrInvalidAPIKey)
+		return
+	}
+
+	// The signature covers the exact bytes that were sent, so the body is
+	// read in full before it is decoded.
+	defer req.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(resWriter, req.Body, maxWebhookBodySize))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "error reading request data", err)
+		return
+	}
+
+	if cfg.config.PolkaWebhookSecret != "" {
+		err = auth.VerifyWebhookSignature(req.Header, cfg.config.PolkaWebhookSecret.Value(), body, time.Now(), cfg.config.PolkaWebhookMaxSkew)
+		if err != nil {
+			respondWithError(resWriter, http.StatusUnauthorized, "invalid webhook signature", err)
+			return
+		}
+	}
+
+	params := parametersWebhook{}
+	if err := json.Unmarshal(body, &params); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error decoding request data", err)
+		return
+	}
+
+	// A signature only stops replays of an event within the allowed skew if
+	// the event can be told apart from its replays.
+	if cfg.config.PolkaWebhookSecret != "" && params.ID == "" {
+		respondWithError(resWriter, http.StatusBadRequest, ErrWebhookEventIDRequired.Error(), ErrWebhookEventIDRequired)
+		return
+	}
+
+	applyEvent, ok := cfg.subscriptionEventHandlers()[params.Event]
+	if !ok {
+		// Event names come from the request, so they are not used as labels.
+		cfg.metrics.webhooksProcessed.With("other", "ignored").Inc()
+		resWriter.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Polka redelivers events it did not see acknowledged. Recording the
+	// event ID first means a redelivery is acknowledged without being
+	// applied a second time.
+	if params.ID != "" {
+		recorded, err := cfg.db.CreateWebhookEvent(req.Context(), database.CreateWebhookEventParams{
+			ID: params.ID,
+			Event: params.Event,
+			ReceivedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error recording webhook event", err)
+			return
+		}
+		if recorded == 0 {
+			cfg.metrics.webhooksProcessed.With(params.Event, "duplicate").Inc()
+			resWriter.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	err = applyEvent(req.Context(), params)
+	if err != nil {
+		cfg.metrics.webhooksProcessed.With(params.Event, "failed").Inc()
+		cfg.forgetWebhookEvent(req, params.ID)
+	}
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error retrieving user data", err)
+		return
+	}
+
+	cfg.metrics.webhooksProcessed.With(params.Event, "applied").Inc()
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+// forgetWebhookEvent removes the record of an event that could not be
+// applied, so that Polka's next delivery of it is processed.
+func (cfg *apiConfig) forgetWebhookEvent(req *http.Request, eventID string) {
+	if eventID == "" {
+		return
+	}
+	if err := cfg.db.DeleteWebhookEvent(req.Context(), eventID); err != nil {
+		loggerFromContext(req.Context()).Error("could not forget webhook event", "event_id", eventID, "error", err)
+	}
+}
+
+// sweepWebhookEvents forgets event ids once replays of them fail the signature
+// check. A delivery may be signed up to the allowed skew after it arrives and
+// still be accepted for the skew after that, so ids are kept for twice the skew.
+func (cfg *apiConfig) sweepWebhookEvents(ctx context.Context) error {
+	_, err := cfg.db.DeleteWebhookEventsReceivedBefore(ctx, time.Now().UTC().Add(-2*cfg.config.PolkaWebhookMaxSkew))
+	return err
+}
+
+func (cfg *apiConfig) runWebhookEventSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.sweepWebhookEvents(ctx); err != nil {
+				log.Printf("error sweeping webhook events: %v\n", err)
+			}
+		}
+	}
+}
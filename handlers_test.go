@@ -0,0 +1,2036 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/config"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/ansht2000/atServer/internal/mailer"
+	"github.com/ansht2000/atServer/internal/ratelimit"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// newTestServer serves the full router on top of an in-memory store.
+func newTestServer(t *testing.T) (*apiConfig, *httptest.Server) {
+	t.Helper()
+	conf := config.Default()
+	conf.Platform = config.PlatformDev
+	conf.Secret = "test-secret-that-is-at-least-32-bytes"
+	conf.PolkaKey = "test-polka-key"
+	keyring, err := loadKeyring(conf)
+	if err != nil {
+		t.Fatalf("could not make keyring: %v", err)
+	}
+	cfg := &apiConfig{
+		db: database.NewMemoryStore(),
+		metrics: newAPIMetrics(),
+		config: conf,
+		mailer: &recordingMailer{},
+		keyring: keyring,
+	}
+	cfg.revocations = newRevocationCache(cfg.db, conf.RevocationCacheTTL)
+	server := httptest.NewServer(cfg.routes("."))
+	t.Cleanup(server.Close)
+	return cfg, server
+}
+
+// outsideUTC are time zones for tests of times kept in TIMESTAMP columns,
+// which have no zone of their own.
+var outsideUTC = []*time.Location{
+	time.FixedZone("UTC-5", -5*60*60),
+	time.FixedZone("UTC+9", 9*60*60),
+}
+
+// setLocalTimeZone makes zone the local time zone, and so the in-memory
+// database's, until the test ends.
+func setLocalTimeZone(t *testing.T, zone *time.Location) {
+	t.Helper()
+	local := time.Local
+	time.Local = zone
+	t.Cleanup(func() { time.Local = local })
+}
+
+// recordingMailer keeps sent messages so tests can read links out of them.
+type recordingMailer struct {
+	mu sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *recordingMailer) messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.sent...)
+}
+
+func (m *recordingMailer) withSubject(subject string) []mailer.Message {
+	var matching []mailer.Message
+	for _, msg := range m.messages() {
+		if msg.Subject == subject {
+			matching = append(matching, msg)
+		}
+	}
+	return matching
+}
+
+// mailedToken returns the token from the link in the latest email to with subject.
+func mailedToken(t *testing.T, m *recordingMailer, to, subject string) string {
+	t.Helper()
+	messages := m.withSubject(subject)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
+		}
+		match := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(messages[i].Body)
+		if match == nil {
+			t.Fatalf("expected a link with a token in the email, got: %s", messages[i].Body)
+		}
+		return match[1]
+	}
+	t.Fatalf("no %q email was sent to %s", subject, to)
+	return ""
+}
+
+// doJSON sends payload as JSON and decodes the response body into out when out is not nil.
+func doJSON(t *testing.T, method, url, authorization string, payload, out interface{}) int {
+	t.Helper()
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatalf("could not encode request: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		t.Fatalf("could not build request: %v", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("could not decode response of %s %s: %v", method, url, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// createAndLogin registers a user and returns the login response.
+func createAndLogin(t *testing.T, serverURL, email string) returnValueUsers {
+	t.Helper()
+	params := parametersUsers{Email: email, Password: "hunter2"}
+	if code := doJSON(t, "POST", serverURL+"/api/users", "", params, nil); code != http.StatusCreated {
+		t.Fatalf("expected 201 creating user, got %d", code)
+	}
+	user := returnValueUsers{}
+	if code := doJSON(t, "POST", serverURL+"/api/login", "", params, &user); code != http.StatusOK {
+		t.Fatalf("expected 200 logging in, got %d", code)
+	}
+	return user
+}
+
+func TestUserLifecycle(t *testing.T) {
+	_, server := newTestServer(t)
+
+	user := createAndLogin(t, server.URL, "walt@example.com")
+	if user.Token == "" || user.RefreshToken == "" {
+		t.Fatalf("expected login to return tokens, got: %+v", user)
+	}
+
+	cases := []struct{
+		name string
+		params parametersUsers
+		expectedCode int
+	}{
+		{
+			name: "duplicate email",
+			params: parametersUsers{Email: "walt@example.com", Password: "other"},
+			expectedCode: http.StatusConflict,
+		},
+	}
+	for _, c := range cases {
+		if code := doJSON(t, "POST", server.URL+"/api/users", "", c.params, nil); code != c.expectedCode {
+			t.Errorf("Test failed for %s: expected %d, got %d", c.name, c.expectedCode, code)
+		}
+	}
+
+	loginCases := []struct{
+		params parametersUsers
+		expectedCode int
+	}{
+		{
+			params: parametersUsers{Email: "walt@example.com", Password: "wrong"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			params: parametersUsers{Email: "nobody@example.com", Password: "hunter2"},
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, c := range loginCases {
+		if code := doJSON(t, "POST", server.URL+"/api/login", "", c.params, nil); code != c.expectedCode {
+			t.Errorf("Test failed for login as %s: expected %d, got %d", c.params.Email, c.expectedCode, code)
+		}
+	}
+
+	refreshed := returnValueRefreshToken{}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+user.RefreshToken, nil, &refreshed); code != http.StatusOK {
+		t.Fatalf("expected 200 refreshing, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/revoke", "Bearer "+user.RefreshToken, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+user.RefreshToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected revoked refresh token to be rejected, got %d", code)
+	}
+}
+
+func TestChirpLifecycle(t *testing.T) {
+	_, server := newTestServer(t)
+
+	author := createAndLogin(t, server.URL, "author@example.com")
+	other := createAndLogin(t, server.URL, "other@example.com")
+
+	chirp := returnValueChirps{}
+	code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+author.Token, parametersChirps{Body: "what a kerfuffle"}, &chirp)
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201 creating chirp, got %d", code)
+	}
+	if chirp.Body != "what a ****" {
+		t.Errorf("expected chirp body to be filtered, got: %s", chirp.Body)
+	}
+
+	chirps := []returnValueChirps{}
+	if code := doJSON(t, "GET", server.URL+"/api/chirps?author_id="+author.Id.String(), "", nil, &chirps); code != http.StatusOK {
+		t.Fatalf("expected 200 listing chirps, got %d", code)
+	}
+	if len(chirps) != 1 || chirps[0].Id != chirp.Id {
+		t.Errorf("expected one chirp from author, got: %+v", chirps)
+	}
+
+	chirpURL := server.URL + "/api/chirps/" + chirp.Id.String()
+	cases := []struct{
+		name string
+		authorization string
+		expectedCode int
+	}{
+		{
+			name: "no token",
+			authorization: "",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "different author",
+			authorization: "Bearer " + other.Token,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "author",
+			authorization: "Bearer " + author.Token,
+			expectedCode: http.StatusNoContent,
+		},
+	}
+	for _, c := range cases {
+		if code := doJSON(t, "DELETE", chirpURL, c.authorization, nil, nil); code != c.expectedCode {
+			t.Errorf("Test failed deleting chirp as %s: expected %d, got %d", c.name, c.expectedCode, code)
+		}
+	}
+
+	if code := doJSON(t, "GET", chirpURL, "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected deleted chirp to be gone, got %d", code)
+	}
+}
+
+func TestChirpPagination(t *testing.T) {
+	_, server := newTestServer(t)
+
+	author := createAndLogin(t, server.URL, "author@example.com")
+	other := createAndLogin(t, server.URL, "other@example.com")
+	created := []returnValueChirps{}
+	for i := 0; i < 5; i++ {
+		chirp := returnValueChirps{}
+		doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+author.Token, parametersChirps{Body: "chirp"}, &chirp)
+		created = append(created, chirp)
+	}
+	doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+other.Token, parametersChirps{Body: "not by author"}, nil)
+
+	cases := []struct{
+		sort string
+		expected []returnValueChirps
+	}{
+		{
+			sort: "asc",
+			expected: created,
+		},
+		{
+			sort: "desc",
+			expected: []returnValueChirps{created[4], created[3], created[2], created[1], created[0]},
+		},
+	}
+
+	for _, c := range cases {
+		seen := []returnValueChirps{}
+		url := server.URL + "/api/chirps?limit=2&sort=" + c.sort + "&author_id=" + author.Id.String()
+		for pages := 0; pages < 10; pages++ {
+			page := returnValueChirpsPage{}
+			if code := doJSON(t, "GET", url, "", nil, &page); code != http.StatusOK {
+				t.Fatalf("expected 200 listing chirps, got %d", code)
+			}
+			seen = append(seen, page.Chirps...)
+			if page.NextCursor == nil {
+				break
+			}
+			url = server.URL + "/api/chirps?limit=2&sort=" + c.sort + "&author_id=" + author.Id.String() + "&cursor=" + *page.NextCursor
+		}
+
+		if len(seen) != len(c.expected) {
+			t.Fatalf("Test failed for sort %s: expected %d chirps, got %d", c.sort, len(c.expected), len(seen))
+		}
+		for i := range seen {
+			if seen[i].Id != c.expected[i].Id {
+				t.Errorf("Test failed for sort %s: chirp %d out of order", c.sort, i)
+			}
+		}
+	}
+
+	invalid := []string{"limit=0", "limit=101", "limit=ten", "cursor=not-a-cursor"}
+	for _, query := range invalid {
+		if code := doJSON(t, "GET", server.URL+"/api/chirps?"+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, code)
+		}
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	cfg, server := newTestServer(t)
+	user := createAndLogin(t, server.URL, "walt@example.com")
+
+	if _, err := cfg.db.GetRefreshToken(context.Background(), user.RefreshToken); err != sql.ErrNoRows {
+		t.Errorf("expected the raw refresh token not to be stored, got: %v", err)
+	}
+
+	first := returnValueRefreshToken{}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+user.RefreshToken, nil, &first); code != http.StatusOK {
+		t.Fatalf("expected 200 refreshing, got %d", code)
+	}
+	if first.RefreshToken == "" || first.RefreshToken == user.RefreshToken {
+		t.Fatalf("expected a new refresh token, got %q", first.RefreshToken)
+	}
+	second := returnValueRefreshToken{}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+first.RefreshToken, nil, &second); code != http.StatusOK {
+		t.Fatalf("expected 200 refreshing with rotated token, got %d", code)
+	}
+
+	// Replaying a rotated token revokes every token in its family.
+	cases := []struct{
+		name string
+		token string
+	}{
+		{
+			name: "replayed login token",
+			token: user.RefreshToken,
+		},
+		{
+			name: "latest token in family",
+			token: second.RefreshToken,
+		},
+	}
+	for _, c := range cases {
+		if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+c.token, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("Test failed for %s: expected 401, got %d", c.name, code)
+		}
+	}
+
+	other := returnValueRefreshToken{}
+	otherLogin := returnValueUsers{}
+	doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "walt@example.com", Password: "hunter2"}, &otherLogin)
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+otherLogin.RefreshToken, nil, &other); code != http.StatusOK {
+		t.Errorf("expected other sessions to be unaffected, got %d", code)
+	}
+}
+
+// postWebhook delivers a Polka webhook, signing it when secret is not empty.
+func postWebhook(t *testing.T, serverURL, secret string, timestamp time.Time, payload interface{}) int {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("could not encode webhook: %v", err)
+	}
+	req, err := http.NewRequest("POST", serverURL+"/api/polka/webhooks", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("could not build request: %v", err)
+	}
+	req.Header.Set("Authorization", "ApiKey test-polka-key")
+	if secret != "" {
+		auth.SetWebhookSignature(req.Header, secret, timestamp, body)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("webhook delivery failed: %v", err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func upgradeEvent(id string, userID uuid.UUID) parametersWebhook {
+	event := parametersWebhook{ID: id, Event: "user.upgraded"}
+	event.Data.UserID = userID
+	return event
+}
+
+func TestSignedWebhooks(t *testing.T) {
+	cfg, server := newTestServer(t)
+	cfg.config.PolkaWebhookSecret = "polka-secret"
+
+	first := createAndLogin(t, server.URL, "first@example.com")
+	second := createAndLogin(t, server.URL, "second@example.com")
+
+	cases := []struct{
+		name string
+		secret string
+		timestamp time.Time
+		event parametersWebhook
+		expectedCode int
+	}{
+		{
+			name: "unsigned",
+			secret: "",
+			timestamp: time.Now(),
+			event: upgradeEvent("evt_1", first.Id),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong secret",
+			secret: "not-the-secret",
+			timestamp: time.Now(),
+			event: upgradeEvent("evt_1", first.Id),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "stale timestamp",
+			secret: "polka-secret",
+			timestamp: time.Now().Add(-time.Hour),
+			event: upgradeEvent("evt_1", first.Id),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "signed event without id",
+			secret: "polka-secret",
+			timestamp: time.Now(),
+			event: upgradeEvent("", first.Id),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "unknown user is retried later",
+			secret: "polka-secret",
+			timestamp: time.Now(),
+			event: upgradeEvent("evt_2", uuid.New()),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "valid",
+			secret: "polka-secret",
+			timestamp: time.Now(),
+			event: upgradeEvent("evt_1", first.Id),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name: "redelivered event id",
+			secret: "polka-secret",
+			timestamp: time.Now(),
+			event: upgradeEvent("evt_1", second.Id),
+			expectedCode: http.StatusNoContent,
+		},
+	}
+
+	for _, c := range cases {
+		if code := postWebhook(t, server.URL, c.secret, c.timestamp, c.event); code != c.expectedCode {
+			t.Errorf("Test failed for %s: expected %d, got %d", c.name, c.expectedCode, code)
+		}
+	}
+
+	firstUser, _ := cfg.db.GetUserFromEmail(context.Background(), "first@example.com")
+	secondUser, _ := cfg.db.GetUserFromEmail(context.Background(), "second@example.com")
+	if !firstUser.IsChirpyRed || secondUser.IsChirpyRed {
+		t.Errorf("expected evt_1 to be applied exactly once")
+	}
+
+	// evt_2 failed, so its redelivery is applied.
+	if code := postWebhook(t, server.URL, "polka-secret", time.Now(), upgradeEvent("evt_2", second.Id)); code != http.StatusNoContent {
+		t.Errorf("expected retried event to be accepted, got %d", code)
+	}
+	secondUser, _ = cfg.db.GetUserFromEmail(context.Background(), "second@example.com")
+	if !secondUser.IsChirpyRed {
+		t.Errorf("expected retried event to be applied")
+	}
+
+	// Once the ids are swept, only the signature timestamp stops a replay.
+	if err := cfg.sweepWebhookEvents(context.Background()); err != nil {
+		t.Fatalf("could not sweep webhook events: %v", err)
+	}
+	if code := postWebhook(t, server.URL, "polka-secret", time.Now(), upgradeEvent("evt_1", first.Id)); code != http.StatusNoContent {
+		t.Errorf("expected redelivery within the skew to still be acknowledged, got %d", code)
+	}
+	// A delivery signed ahead of its arrival can be replayed for up to twice
+	// the skew.
+	early := database.CreateWebhookEventParams{ID: "evt_early", Event: "user.upgraded", ReceivedAt: time.Now().UTC().Add(-3 * cfg.config.PolkaWebhookMaxSkew / 2)}
+	if _, err := cfg.db.CreateWebhookEvent(context.Background(), early); err != nil {
+		t.Fatalf("could not record webhook event: %v", err)
+	}
+	if err := cfg.sweepWebhookEvents(context.Background()); err != nil {
+		t.Fatalf("could not sweep webhook events: %v", err)
+	}
+	if recorded, _ := cfg.db.CreateWebhookEvent(context.Background(), early); recorded != 0 {
+		t.Errorf("expected evt_early to be remembered for twice the skew")
+	}
+	cfg.config.PolkaWebhookMaxSkew = 0
+	if err := cfg.sweepWebhookEvents(context.Background()); err != nil {
+		t.Fatalf("could not sweep webhook events: %v", err)
+	}
+	if recorded, _ := cfg.db.CreateWebhookEvent(context.Background(), database.CreateWebhookEventParams{ID: "evt_1", Event: "user.upgraded", ReceivedAt: time.Now().UTC()}); recorded != 1 {
+		t.Errorf("expected evt_1 to be forgotten once older than the skew")
+	}
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	cfg, server := newTestServer(t)
+	user := createAndLogin(t, server.URL, "red@example.com")
+
+	subscriptionEvent := func(id, event string, periodEnd *time.Time) parametersWebhook {
+		params := parametersWebhook{ID: id, Event: event}
+		params.Data.UserID = user.Id
+		params.Data.PeriodEnd = periodEnd
+		return params
+	}
+	periodEnd := time.Now().Add(time.Hour).UTC()
+	lapsedEnd := time.Now().Add(-time.Hour).UTC()
+
+	cases := []struct{
+		name string
+		event parametersWebhook
+		expectedStatus string
+		expectedRed bool
+	}{
+		{
+			name: "upgrade",
+			event: subscriptionEvent("evt_1", "user.upgraded", &periodEnd),
+			expectedStatus: subscriptionStatusActive,
+			expectedRed: true,
+		},
+		{
+			name: "downgrade",
+			event: subscriptionEvent("evt_2", "user.downgraded", nil),
+			expectedStatus: subscriptionStatusCanceled,
+			expectedRed: false,
+		},
+		{
+			name: "renewal",
+			event: subscriptionEvent("evt_3", "subscription.renewed", nil),
+			expectedStatus: subscriptionStatusActive,
+			expectedRed: true,
+		},
+		{
+			name: "expiry",
+			event: subscriptionEvent("evt_4", "subscription.expired", nil),
+			expectedStatus: subscriptionStatusExpired,
+			expectedRed: false,
+		},
+		{
+			name: "renewal with a period that already ended",
+			event: subscriptionEvent("evt_5", "subscription.renewed", &lapsedEnd),
+			expectedStatus: subscriptionStatusActive,
+			expectedRed: true,
+		},
+	}
+
+	for _, c := range cases {
+		if code := postWebhook(t, server.URL, "", time.Now(), c.event); code != http.StatusNoContent {
+			t.Fatalf("Test failed for %s: expected 204, got %d", c.name, code)
+		}
+		subscription := returnValueSubscription{}
+		if code := doJSON(t, "GET", server.URL+"/api/users/me/subscription", "Bearer "+user.Token, nil, &subscription); code != http.StatusOK {
+			t.Fatalf("Test failed for %s: expected 200 getting subscription, got %d", c.name, code)
+		}
+		if subscription.Status != c.expectedStatus || subscription.IsChirpyRed != c.expectedRed {
+			t.Errorf("Test failed for %s: got status %s and is_chirpy_red %v", c.name, subscription.Status, subscription.IsChirpyRed)
+		}
+	}
+
+	if err := cfg.sweepExpiredSubscriptions(context.Background()); err != nil {
+		t.Fatalf("could not sweep subscriptions: %v", err)
+	}
+	subscription := returnValueSubscription{}
+	doJSON(t, "GET", server.URL+"/api/users/me/subscription", "Bearer "+user.Token, nil, &subscription)
+	if subscription.Status != subscriptionStatusExpired || subscription.IsChirpyRed {
+		t.Errorf("expected sweeper to expire the lapsed subscription, got status %s", subscription.Status)
+	}
+	if len(subscription.History) != len(cases)+1 {
+		t.Errorf("expected %d history entries, got %d", len(cases)+1, len(subscription.History))
+	}
+}
+
+func TestSubscriptionExpiryOutsideUTC(t *testing.T) {
+	polkaZone := time.FixedZone("UTC+3", 3*60*60)
+	for _, zone := range outsideUTC {
+		setLocalTimeZone(t, zone)
+		cfg, server := newTestServer(t)
+		paid := createAndLogin(t, server.URL, "paid@example.com")
+		lapsed := createAndLogin(t, server.URL, "lapsed@example.com")
+
+		cases := []struct{
+			user returnValueUsers
+			periodEnd time.Time
+			expectedStatus string
+		}{
+			{user: paid, periodEnd: time.Now().Add(time.Hour).In(polkaZone), expectedStatus: subscriptionStatusActive},
+			{user: lapsed, periodEnd: time.Now().Add(-time.Hour).In(polkaZone), expectedStatus: subscriptionStatusExpired},
+		}
+
+		for _, c := range cases {
+			event := upgradeEvent("evt_"+c.user.Email, c.user.Id)
+			event.Data.PeriodEnd = &c.periodEnd
+			if code := postWebhook(t, server.URL, "", time.Now(), event); code != http.StatusNoContent {
+				t.Fatalf("Test failed for %s in %s: expected 204, got %d", c.user.Email, zone, code)
+			}
+		}
+		if err := cfg.sweepExpiredSubscriptions(context.Background()); err != nil {
+			t.Fatalf("could not sweep subscriptions: %v", err)
+		}
+		for _, c := range cases {
+			subscription := returnValueSubscription{}
+			doJSON(t, "GET", server.URL+"/api/users/me/subscription", "Bearer "+c.user.Token, nil, &subscription)
+			if subscription.Status != c.expectedStatus {
+				t.Errorf("Test failed for %s in %s: expected status %s but got %s", c.user.Email, zone, c.expectedStatus, subscription.Status)
+			}
+		}
+	}
+}
+
+func TestMetricsEndpoints(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	apiCfg.config.AdminAPIKey = "test-admin-key"
+
+	for i := 0; i < 2; i++ {
+		res, err := http.Get(server.URL + "/app/")
+		if err != nil {
+			t.Fatalf("could not get /app/: %v", err)
+		}
+		res.Body.Close()
+	}
+	user := createAndLogin(t, server.URL, "walt@example.com")
+	doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "walt@example.com", Password: "wrong"}, nil)
+	doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+user.Token, parametersChirps{Body: "hello"}, nil)
+	doJSON(t, "BREW", server.URL+"/api/chirps", "", nil, nil)
+
+	if code := doJSON(t, "GET", server.URL+"/admin/metrics", "Bearer "+user.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 reading metrics as a regular user, got %d", code)
+	}
+
+	scrape := func(path string) string {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("could not build request: %v", err)
+		}
+		req.Header.Set("Authorization", "ApiKey test-admin-key")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not get %s: %v", path, err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("could not read %s: %v", path, err)
+		}
+		return string(body)
+	}
+
+	html := scrape("/admin/metrics")
+	if !strings.Contains(html, "visited 2 times") {
+		t.Errorf("expected HTML metrics to count 2 visits, got: %s", html)
+	}
+
+	exposition := scrape("/admin/metrics/prometheus")
+	expectedLines := []string{
+		"chirpy_fileserver_hits_total 2",
+		"chirpy_logins_total 1",
+		"chirpy_failed_logins_total 1",
+		"chirpy_chirps_created_total 1",
+		`chirpy_http_requests_total{method="POST",route="POST /api/chirps",status="201"} 1`,
+		`chirpy_http_error_responses_total{route="POST /api/login",status="401"} 1`,
+		`chirpy_http_request_duration_seconds_count{method="POST",route="POST /api/users"} 1`,
+		`chirpy_http_requests_total{method="other",route="unmatched",status="405"} 1`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("expected exposition to contain %q", line)
+		}
+	}
+	if strings.Contains(exposition, "BREW") {
+		t.Errorf("expected made-up methods to share the other label")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	databaseUp := true
+	apiCfg.readinessChecks = []readinessCheck{{
+		name: "database",
+		check: func(ctx context.Context) error {
+			if !databaseUp {
+				return ErrDatabaseUnreachable
+			}
+			return nil
+		},
+	}}
+
+	cases := []struct{
+		name string
+		draining bool
+		databaseUp bool
+		expectedStatus int
+		expectedFailed []string
+	}{
+		{name: "healthy", databaseUp: true, expectedStatus: http.StatusOK},
+		{name: "database down", databaseUp: false, expectedStatus: http.StatusServiceUnavailable, expectedFailed: []string{"database"}},
+		{name: "draining", draining: true, databaseUp: true, expectedStatus: http.StatusServiceUnavailable, expectedFailed: []string{"shutdown"}},
+	}
+
+	for _, c := range cases {
+		apiCfg.draining.Store(c.draining)
+		databaseUp = c.databaseUp
+
+		var readiness returnValueReadiness
+		if code := doJSON(t, "GET", server.URL+"/api/readyz", "", nil, &readiness); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+		failed := []string{}
+		for _, check := range readiness.Checks {
+			if check.Status != readinessStatusOK {
+				failed = append(failed, check.Name)
+			}
+		}
+		if strings.Join(failed, ",") != strings.Join(c.expectedFailed, ",") {
+			t.Errorf("Test failed for %s, expected failed checks %v but got %v", c.name, c.expectedFailed, failed)
+		}
+		if len(readiness.Checks) != 2 {
+			t.Errorf("Test failed for %s, expected 2 checks but got %d", c.name, len(readiness.Checks))
+		}
+
+		// Liveness never depends on the database or shutdown state.
+		res, err := http.Get(server.URL + "/api/healthz")
+		if err != nil {
+			t.Fatalf("could not get /api/healthz: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Test failed for %s, expected healthz to return 200 but got %d", c.name, res.StatusCode)
+		}
+	}
+}
+
+func TestRateLimiting(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	apiCfg.rateLimits = map[string]ratelimit.Limit{
+		"POST /api/login": {Requests: 3, Per: time.Minute},
+		"POST /api/chirps": {Requests: 1, Per: time.Minute},
+	}
+	apiCfg.config.RateLimitRedMultiplier = 2
+
+	red := createAndLogin(t, server.URL, "red@example.com")
+	plain := createAndLogin(t, server.URL, "plain@example.com")
+	if code := postWebhook(t, server.URL, "", time.Now(), upgradeEvent("evt_red", red.Id)); code != http.StatusNoContent {
+		t.Fatalf("expected 204 upgrading user, got %d", code)
+	}
+
+	// Chirps are limited per user, with Chirpy Red users getting twice as many.
+	cases := []struct{
+		name string
+		token string
+		expectedStatus int
+	}{
+		{name: "plain first chirp", token: plain.Token, expectedStatus: http.StatusCreated},
+		{name: "plain second chirp", token: plain.Token, expectedStatus: http.StatusTooManyRequests},
+		{name: "red first chirp", token: red.Token, expectedStatus: http.StatusCreated},
+		{name: "red second chirp", token: red.Token, expectedStatus: http.StatusCreated},
+		{name: "red third chirp", token: red.Token, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, c := range cases {
+		if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+c.token, parametersChirps{Body: "hello"}, nil); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+
+	// Logins are anonymous, so both users above share the client IP's bucket.
+	login := func() *http.Response {
+		body, _ := json.Marshal(parametersUsers{Email: "plain@example.com", Password: "hunter2"})
+		res, err := http.Post(server.URL+"/api/login", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+		res.Body.Close()
+		return res
+	}
+	if res := login(); res.StatusCode != http.StatusOK || res.Header.Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected the third login to use the last token, got %d with %q remaining", res.StatusCode, res.Header.Get("RateLimit-Remaining"))
+	}
+	res := login()
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for the fourth login, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") != "20" || res.Header.Get("RateLimit-Limit") != "3" {
+		t.Errorf("unexpected rate limit headers: %v", res.Header)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	apiCfg.config.LoginMaxFailures = 3
+	apiCfg.config.LoginMaxFailuresPerIP = 100
+	apiCfg.config.AdminAPIKey = "test-admin-key"
+	user := createAndLogin(t, server.URL, "locked@example.com")
+
+	type errorResponse struct {
+		Error string `json:"error"`
+	}
+	login := func(email, password string) (int, string) {
+		res := errorResponse{}
+		code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: email, Password: password}, &res)
+		return code, res.Error
+	}
+	unlock := func(apiKey string) int {
+		req, err := http.NewRequest("POST", server.URL+"/admin/users/"+user.Id.String()+"/unlock", nil)
+		if err != nil {
+			t.Fatalf("could not build request: %v", err)
+		}
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unlock failed: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	cases := []struct{
+		name string
+		email string
+		password string
+		expectedStatus int
+	}{
+		{name: "first failure", email: "locked@example.com", password: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "second failure", email: "locked@example.com", password: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "success resets the count", email: "locked@example.com", password: "hunter2", expectedStatus: http.StatusOK},
+		{name: "failure after reset", email: "locked@example.com", password: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "failure after reset", email: "locked@example.com", password: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "failure that locks", email: "locked@example.com", password: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "right password while locked", email: "locked@example.com", password: "hunter2", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown account", email: "nobody@example.com", password: "hunter2", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		code, message := login(c.email, c.password)
+		if code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+		if code == http.StatusUnauthorized && message != "incorrect email or password" {
+			t.Errorf("Test failed for %s, expected the generic error but got %q", c.name, message)
+		}
+	}
+
+	events, err := apiCfg.db.GetLoginLockoutEventsByUserID(context.Background(), uuid.NullUUID{UUID: user.Id, Valid: true})
+	if err != nil || len(events) != 1 || events[0].Event != lockoutEventLocked || events[0].FailedAttempts != 3 {
+		t.Errorf("expected one lockout event after three failures, got %+v (%v)", events, err)
+	}
+
+	if code := unlock("wrong-key"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 unlocking with the wrong key, got %d", code)
+	}
+	if code := unlock("test-admin-key"); code != http.StatusNoContent {
+		t.Errorf("expected 204 unlocking, got %d", code)
+	}
+	if code, _ := login("locked@example.com", "hunter2"); code != http.StatusOK {
+		t.Errorf("expected login to succeed after unlock, got %d", code)
+	}
+	events, _ = apiCfg.db.GetLoginLockoutEventsByUserID(context.Background(), uuid.NullUUID{UUID: user.Id, Valid: true})
+	if len(events) != 2 || events[0].Event != lockoutEventUnlocked {
+		t.Errorf("expected an unlock event to be recorded, got %+v", events)
+	}
+
+	// The client IP is locked separately, even for accounts that do not exist.
+	apiCfg.config.LoginMaxFailuresPerIP = 2
+	login("nobody@example.com", "hunter2")
+	if code, _ := login("locked@example.com", "hunter2"); code != http.StatusUnauthorized {
+		t.Errorf("expected a locked client IP to be rejected, got %d", code)
+	}
+}
+
+func TestLoginLockoutOutsideUTC(t *testing.T) {
+	for _, zone := range outsideUTC {
+		setLocalTimeZone(t, zone)
+		apiCfg, server := newTestServer(t)
+		apiCfg.config.LoginMaxFailures = 3
+		apiCfg.config.LoginMaxFailuresPerIP = 100
+		apiCfg.config.LoginFailureWindow = 2 * time.Second
+		createAndLogin(t, server.URL, "locked@example.com")
+		login := func(password string) int {
+			return doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "locked@example.com", Password: password}, nil)
+		}
+
+		// Failures from before the window are forgotten.
+		login("wrong")
+		login("wrong")
+		time.Sleep(apiCfg.config.LoginFailureWindow)
+		login("wrong")
+		if code := login("hunter2"); code != http.StatusOK {
+			t.Errorf("Test failed for %s, expected old failures to be forgotten but got %d", zone, code)
+		}
+
+		// Failures within the window add up.
+		login("wrong")
+		login("wrong")
+		login("wrong")
+		if code := login("hunter2"); code != http.StatusUnauthorized {
+			t.Errorf("Test failed for %s, expected the account to be locked but got %d", zone, code)
+		}
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	apiCfg := &apiConfig{config: config.Default()}
+	apiCfg.config.LoginLockoutBase = time.Minute
+	apiCfg.config.LoginLockoutMax = time.Hour
+
+	cases := []struct{
+		previousLockouts int32
+		expected time.Duration
+	}{
+		{previousLockouts: 0, expected: time.Minute},
+		{previousLockouts: 1, expected: 2 * time.Minute},
+		{previousLockouts: 3, expected: 8 * time.Minute},
+		{previousLockouts: 6, expected: time.Hour},
+		{previousLockouts: 1000, expected: time.Hour},
+	}
+
+	for _, c := range cases {
+		if actual := apiCfg.lockoutDuration(c.previousLockouts); actual != c.expected {
+			t.Errorf("Test failed for %d previous lockouts, expected %s but got %s", c.previousLockouts, c.expected, actual)
+		}
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	mail := apiCfg.mailer.(*recordingMailer)
+	user := createAndLogin(t, server.URL, "forgetful@example.com")
+
+	if code := doJSON(t, "POST", server.URL+"/api/password/forgot", "", parametersForgotPassword{Email: "nobody@example.com"}, nil); code != http.StatusAccepted {
+		t.Errorf("expected 202 for an unknown email, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/password/forgot", "", parametersForgotPassword{Email: "forgetful@example.com"}, nil); code != http.StatusAccepted {
+		t.Errorf("expected 202 for a known email, got %d", code)
+	}
+	if len(mail.withSubject("Reset your Chirpy password")) != 1 {
+		t.Fatalf("expected exactly one reset email, got %+v", mail.messages())
+	}
+	token := mailedToken(t, mail, "forgetful@example.com", "Reset your Chirpy password")
+
+	expiredToken := "expired-token"
+	_, err := apiCfg.db.CreatePasswordResetToken(context.Background(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(expiredToken),
+		UserID: user.Id,
+		ExpiresAt: time.Now().UTC().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("could not create expired token: %v", err)
+	}
+
+	cases := []struct{
+		name string
+		params parametersResetPassword
+		expectedStatus int
+	}{
+		{name: "unknown token", params: parametersResetPassword{Token: "nope", Password: "new-password"}, expectedStatus: http.StatusBadRequest},
+		{name: "expired token", params: parametersResetPassword{Token: expiredToken, Password: "new-password"}, expectedStatus: http.StatusBadRequest},
+		{name: "empty password", params: parametersResetPassword{Token: token, Password: ""}, expectedStatus: http.StatusBadRequest},
+		{name: "valid token", params: parametersResetPassword{Token: token, Password: "new-password"}, expectedStatus: http.StatusNoContent},
+		{name: "token reused", params: parametersResetPassword{Token: token, Password: "other-password"}, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		if code := doJSON(t, "POST", server.URL+"/api/password/reset", "", c.params, nil); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+user.RefreshToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected refresh tokens to be revoked by the reset, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "forgetful@example.com", Password: "hunter2"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected the old password to stop working, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "forgetful@example.com", Password: "new-password"}, nil); code != http.StatusOK {
+		t.Errorf("expected the new password to work, got %d", code)
+	}
+}
+
+func TestPasswordResetOutsideUTC(t *testing.T) {
+	for _, zone := range outsideUTC {
+		setLocalTimeZone(t, zone)
+		apiCfg, server := newTestServer(t)
+		user := createAndLogin(t, server.URL, "forgetful@example.com")
+		if code := doJSON(t, "POST", server.URL+"/api/password/forgot", "", parametersForgotPassword{Email: "forgetful@example.com"}, nil); code != http.StatusAccepted {
+			t.Fatalf("Test failed for %s, expected 202 but got %d", zone, code)
+		}
+		token := mailedToken(t, apiCfg.mailer.(*recordingMailer), "forgetful@example.com", "Reset your Chirpy password")
+		_, err := apiCfg.db.CreatePasswordResetToken(context.Background(), database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashToken("expired-token"),
+			UserID: user.Id,
+			ExpiresAt: time.Now().UTC().Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("could not create expired token: %v", err)
+		}
+
+		if code := doJSON(t, "POST", server.URL+"/api/password/reset", "", parametersResetPassword{Token: "expired-token", Password: "new-password"}, nil); code != http.StatusBadRequest {
+			t.Errorf("Test failed for %s, expected an expired token to be rejected but got %d", zone, code)
+		}
+		if code := doJSON(t, "POST", server.URL+"/api/password/reset", "", parametersResetPassword{Token: token, Password: "new-password"}, nil); code != http.StatusNoContent {
+			t.Errorf("Test failed for %s, expected a fresh token to work but got %d", zone, code)
+		}
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	apiCfg.config.RequireVerifiedEmail = true
+	mail := apiCfg.mailer.(*recordingMailer)
+	const subject = "Verify your Chirpy email address"
+
+	if code := doJSON(t, "POST", server.URL+"/api/users", "", parametersUsers{Email: "not an email", Password: "hunter2"}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid email, got %d", code)
+	}
+
+	user := createAndLogin(t, server.URL, "unverified@example.com")
+	if user.IsEmailVerified {
+		t.Errorf("expected a new user to be unverified")
+	}
+	signupToken := mailedToken(t, mail, "unverified@example.com", subject)
+
+	if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+user.Token, parametersChirps{Body: "hello"}, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 posting before verifying, got %d", code)
+	}
+
+	// Changing the email before verifying makes the first link useless.
+	update := parametersUsers{Email: "changed@example.com", Password: "hunter2"}
+	updated := returnValueUsers{}
+	if code := doJSON(t, "PUT", server.URL+"/api/users", "Bearer "+user.Token, update, &updated); code != http.StatusOK {
+		t.Fatalf("expected 200 changing email, got %d", code)
+	}
+	changedToken := mailedToken(t, mail, "changed@example.com", subject)
+
+	cases := []struct{
+		name string
+		token string
+		expectedStatus int
+		expectedVerified bool
+	}{
+		{name: "token for the old email", token: signupToken, expectedStatus: http.StatusBadRequest},
+		{name: "unknown token", token: "nope", expectedStatus: http.StatusBadRequest},
+		{name: "token for the current email", token: changedToken, expectedStatus: http.StatusOK, expectedVerified: true},
+		{name: "token reused", token: changedToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		verified := returnValueUsers{}
+		code := doJSON(t, "POST", server.URL+"/api/users/verify", "", parametersVerifyEmail{Token: c.token}, &verified)
+		if code != c.expectedStatus || verified.IsEmailVerified != c.expectedVerified {
+			t.Errorf("Test failed for %s, expected %d (verified %v) but got %d (verified %v)", c.name, c.expectedStatus, c.expectedVerified, code, verified.IsEmailVerified)
+		}
+	}
+
+	if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+updated.Token, parametersChirps{Body: "hello"}, nil); code != http.StatusCreated {
+		t.Errorf("expected 201 posting after verifying, got %d", code)
+	}
+}
+
+func TestEmailVerificationOutsideUTC(t *testing.T) {
+	for _, zone := range outsideUTC {
+		setLocalTimeZone(t, zone)
+		apiCfg, server := newTestServer(t)
+		user := createAndLogin(t, server.URL, "unverified@example.com")
+		token := mailedToken(t, apiCfg.mailer.(*recordingMailer), "unverified@example.com", "Verify your Chirpy email address")
+		_, err := apiCfg.db.CreateEmailVerificationToken(context.Background(), database.CreateEmailVerificationTokenParams{
+			TokenHash: auth.HashToken("expired-token"),
+			UserID: user.Id,
+			Email: "unverified@example.com",
+			ExpiresAt: time.Now().UTC().Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("could not create expired token: %v", err)
+		}
+
+		if code := doJSON(t, "POST", server.URL+"/api/users/verify", "", parametersVerifyEmail{Token: "expired-token"}, nil); code != http.StatusBadRequest {
+			t.Errorf("Test failed for %s, expected an expired token to be rejected but got %d", zone, code)
+		}
+		if code := doJSON(t, "POST", server.URL+"/api/users/verify", "", parametersVerifyEmail{Token: token}, nil); code != http.StatusOK {
+			t.Errorf("Test failed for %s, expected a fresh token to work but got %d", zone, code)
+		}
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	user := createAndLogin(t, server.URL, "totp@example.com")
+	bearer := "Bearer " + user.Token
+
+	enrollment := returnValueTwoFactorEnrollment{}
+	if code := doJSON(t, "POST", server.URL+"/api/users/me/2fa", bearer, nil, &enrollment); code != http.StatusOK {
+		t.Fatalf("expected 200 enrolling, got %d", code)
+	}
+	if !strings.HasPrefix(enrollment.OTPAuthURI, "otpauth://totp/") {
+		t.Errorf("expected an otpauth uri, got %q", enrollment.OTPAuthURI)
+	}
+	totpCode := func(offset int64) string {
+		t.Helper()
+		code, err := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now())+offset)
+		if err != nil {
+			t.Fatalf("could not make totp code: %v", err)
+		}
+		return code
+	}
+
+	if code := doJSON(t, "POST", server.URL+"/api/users/me/2fa/confirm", bearer, parametersTwoFactorCode{Code: "000000"}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 confirming with a wrong code, got %d", code)
+	}
+	// Confirm with the previous step so the current one is still unused.
+	recovery := returnValueRecoveryCodes{}
+	if code := doJSON(t, "POST", server.URL+"/api/users/me/2fa/confirm", bearer, parametersTwoFactorCode{Code: totpCode(-1)}, &recovery); code != http.StatusOK {
+		t.Fatalf("expected 200 confirming, got %d", code)
+	}
+	if len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery.RecoveryCodes))
+	}
+	// Recovery codes are short, so they are stored with a salted slow hash.
+	stored, err := apiCfg.db.ListUnusedTOTPRecoveryCodesByUserID(context.Background(), user.Id)
+	if err != nil || len(stored) != recoveryCodeCount {
+		t.Fatalf("expected %d stored recovery codes, got %d (%v)", recoveryCodeCount, len(stored), err)
+	}
+	if stored[0].CodeHash == auth.HashToken(recovery.RecoveryCodes[0]) || auth.CheckPasswordHash(recovery.RecoveryCodes[0], stored[0].CodeHash) != nil {
+		t.Errorf("expected recovery codes to be stored with HashPassword, got %q", stored[0].CodeHash)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/users/me/2fa", bearer, nil, nil); code != http.StatusConflict {
+		t.Errorf("expected 409 enrolling twice, got %d", code)
+	}
+
+	login := func() string {
+		t.Helper()
+		challenge := returnValueTwoFactorChallenge{}
+		params := parametersUsers{Email: "totp@example.com", Password: "hunter2"}
+		if code := doJSON(t, "POST", server.URL+"/api/login", "", params, &challenge); code != http.StatusOK {
+			t.Fatalf("expected 200 logging in, got %d", code)
+		}
+		if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+			t.Fatalf("expected a two-factor challenge, got %+v", challenge)
+		}
+		return challenge.ChallengeToken
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/users/me/2fa", "Bearer "+login(), nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 using a challenge token as an access token, got %d", code)
+	}
+
+	currentCode := totpCode(0)
+	cases := []struct{
+		name string
+		params parametersLoginTwoFactor
+		expectedStatus int
+	}{
+		{name: "wrong code", params: parametersLoginTwoFactor{Code: "000000"}, expectedStatus: http.StatusUnauthorized},
+		{name: "current code", params: parametersLoginTwoFactor{Code: currentCode}, expectedStatus: http.StatusOK},
+		{name: "replayed code", params: parametersLoginTwoFactor{Code: currentCode}, expectedStatus: http.StatusUnauthorized},
+		{name: "recovery code", params: parametersLoginTwoFactor{RecoveryCode: strings.ToUpper(recovery.RecoveryCodes[0])}, expectedStatus: http.StatusOK},
+		{name: "reused recovery code", params: parametersLoginTwoFactor{RecoveryCode: recovery.RecoveryCodes[0]}, expectedStatus: http.StatusUnauthorized},
+		{name: "bad challenge token", params: parametersLoginTwoFactor{ChallengeToken: user.Token, Code: totpCode(1)}, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		if c.params.ChallengeToken == "" {
+			c.params.ChallengeToken = login()
+		}
+		tokens := returnValueUsers{}
+		code := doJSON(t, "POST", server.URL+"/api/login/2fa", "", c.params, &tokens)
+		if code != c.expectedStatus || (code == http.StatusOK && tokens.Token == "") {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+
+	if code := doJSON(t, "DELETE", server.URL+"/api/users/me/2fa", bearer, parametersTwoFactorCode{Code: "000000"}, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 disabling with a wrong code, got %d", code)
+	}
+	if code := doJSON(t, "DELETE", server.URL+"/api/users/me/2fa", bearer, parametersTwoFactorCode{Code: totpCode(1)}, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 disabling, got %d", code)
+	}
+	tokens := returnValueUsers{}
+	params := parametersUsers{Email: "totp@example.com", Password: "hunter2"}
+	if code := doJSON(t, "POST", server.URL+"/api/login", "", params, &tokens); code != http.StatusOK || tokens.Token == "" {
+		t.Errorf("expected tokens from login once two-factor is off, got %d", code)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	user := createAndLogin(t, server.URL, "jwks@example.com")
+
+	jwks := auth.JWKS{}
+	if code := doJSON(t, "GET", server.URL+"/.well-known/jwks.json", "", nil, &jwks); code != http.StatusOK {
+		t.Fatalf("expected 200 fetching the JWKS, got %d", code)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != apiCfg.keyring.SigningKeyID() || jwks.Keys[0].Algorithm != "EdDSA" {
+		t.Fatalf("expected the signing key in the JWKS, got %+v", jwks.Keys)
+	}
+
+	// A downstream service only needs the published key to verify tokens.
+	x, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	if err != nil {
+		t.Fatalf("could not decode the public key: %v", err)
+	}
+	token, err := jwt.Parse(user.Token, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != jwks.Keys[0].KeyID {
+			return nil, auth.ErrUnknownKeyID
+		}
+		return ed25519.PublicKey(x), nil
+	}, jwt.WithValidMethods([]string{"EdDSA"}))
+	if err != nil || !token.Valid {
+		t.Errorf("expected the access token to verify against the JWKS, got %v", err)
+	}
+}
+
+func TestRolesAndScopes(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	apiCfg.config.AdminAPIKey = "test-admin-key"
+	author := createAndLogin(t, server.URL, "author@example.com")
+	moderator := createAndLogin(t, server.URL, "moderator@example.com")
+
+	chirps := make([]returnValueChirps, 2)
+	for i := range chirps {
+		if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+author.Token, parametersChirps{Body: "hello"}, &chirps[i]); code != http.StatusCreated {
+			t.Fatalf("expected 201 creating chirp, got %d", code)
+		}
+	}
+
+	setRole := func(authorization, role string) int {
+		return doJSON(t, "PUT", server.URL+"/admin/users/"+moderator.Id.String()+"/role", authorization, parametersUserRole{Role: role}, nil)
+	}
+	if code := setRole("Bearer "+moderator.Token, auth.RoleModerator); code != http.StatusForbidden {
+		t.Errorf("expected 403 changing a role as a user, got %d", code)
+	}
+	if code := setRole("ApiKey test-admin-key", "root"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown role, got %d", code)
+	}
+	if code := setRole("ApiKey test-admin-key", auth.RoleModerator); code != http.StatusOK {
+		t.Fatalf("expected 200 changing a role, got %d", code)
+	}
+
+	// The role shows up once the moderator refreshes their access token.
+	refreshed := returnValueRefreshToken{}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+moderator.RefreshToken, nil, &refreshed); code != http.StatusOK {
+		t.Fatalf("expected 200 refreshing, got %d", code)
+	}
+	principal, err := auth.ValidateJWT(context.Background(), refreshed.Token, apiCfg.keyring, nil)
+	if err != nil || !principal.HasRole(auth.RoleModerator) || principal.HasRole(auth.RoleAdmin) {
+		t.Fatalf("expected a moderator token, got %+v (%v)", principal, err)
+	}
+	readOnly, err := auth.MakeJWT(auth.Principal{UserID: author.Id, Roles: []string{auth.RoleUser}, Scopes: []string{auth.ScopeUsersRead}}, apiCfg.keyring, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make token: %v", err)
+	}
+
+	cases := []struct{
+		name string
+		method string
+		path string
+		authorization string
+		expectedStatus int
+	}{
+		{name: "no token", method: "POST", path: "/api/chirps", expectedStatus: http.StatusUnauthorized},
+		{name: "admin key is not a user", method: "POST", path: "/api/chirps", authorization: "ApiKey test-admin-key", expectedStatus: http.StatusUnauthorized},
+		{name: "missing scope", method: "POST", path: "/api/chirps", authorization: "Bearer " + readOnly, expectedStatus: http.StatusForbidden},
+		{name: "scope present", method: "GET", path: "/api/users/me/subscription", authorization: "Bearer " + readOnly, expectedStatus: http.StatusOK},
+		{name: "old moderator token", method: "DELETE", path: "/api/chirps/" + chirps[0].Id.String(), authorization: "Bearer " + moderator.Token, expectedStatus: http.StatusForbidden},
+		{name: "moderator deletes any chirp", method: "DELETE", path: "/api/chirps/" + chirps[0].Id.String(), authorization: "Bearer " + refreshed.Token, expectedStatus: http.StatusNoContent},
+		{name: "moderator is not admin", method: "GET", path: "/admin/metrics", authorization: "Bearer " + refreshed.Token, expectedStatus: http.StatusForbidden},
+		{name: "reset needs admin", method: "POST", path: "/admin/reset", authorization: "Bearer " + author.Token, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		if code := doJSON(t, c.method, server.URL+c.path, c.authorization, parametersChirps{Body: "hello"}, nil); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+}
+
+func TestAdminReset(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	apiCfg.config.AdminAPIKey = "test-admin-key"
+	user := createAndLogin(t, server.URL, "doomed@example.com")
+
+	cases := []struct{
+		name string
+		platform string
+		authorization string
+		expectedStatus int
+	}{
+		{name: "user on prod", platform: config.PlatformProd, authorization: "Bearer " + user.Token, expectedStatus: http.StatusForbidden},
+		{name: "admin on prod", platform: config.PlatformProd, authorization: "ApiKey test-admin-key", expectedStatus: http.StatusOK},
+	}
+	for _, c := range cases {
+		apiCfg.config.Platform = c.platform
+		if code := doJSON(t, "POST", server.URL+"/admin/reset", c.authorization, nil, nil); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+
+	if _, err := apiCfg.db.GetUserByID(context.Background(), user.Id); err != sql.ErrNoRows {
+		t.Errorf("expected the admin reset to delete every user, got: %v", err)
+	}
+}
+
+func TestPersonalAPIKeys(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	user := createAndLogin(t, server.URL, "bot@example.com")
+	keysURL := server.URL + "/api/users/me/api-keys"
+
+	createKey := func(params parametersAPIKey) returnValueAPIKey {
+		t.Helper()
+		apiKey := returnValueAPIKey{}
+		if code := doJSON(t, "POST", keysURL, "Bearer "+user.Token, params, &apiKey); code != http.StatusCreated {
+			t.Fatalf("expected 201 creating api key %s, got %d", params.Name, code)
+		}
+		return apiKey
+	}
+	writer := createKey(parametersAPIKey{Name: "writer", Scopes: []string{auth.ScopeChirpsWrite, auth.ScopeUsersRead}})
+	reader := createKey(parametersAPIKey{Name: "reader", Scopes: []string{auth.ScopeUsersRead}})
+	revoked := createKey(parametersAPIKey{Name: "revoked", Scopes: []string{auth.ScopeChirpsWrite}})
+	manager := createKey(parametersAPIKey{Name: "manager", Scopes: []string{auth.ScopeUsersWrite, auth.ScopeChirpsWrite}})
+	if !strings.HasPrefix(writer.Key, auth.APIKeyPrefix) || !strings.HasPrefix(writer.Key, writer.Prefix) {
+		t.Fatalf("expected the key to be shown once created, got %+v", writer)
+	}
+	if code := doJSON(t, "DELETE", keysURL+"/"+revoked.Id.String(), "Bearer "+user.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking api key, got %d", code)
+	}
+	if code := doJSON(t, "DELETE", keysURL+"/"+revoked.Id.String(), "Bearer "+user.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 revoking api key twice, got %d", code)
+	}
+	// The API only accepts expiries in the future, so the expired key is
+	// written to the store directly.
+	expiredKey, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		t.Fatalf("could not make api key: %v", err)
+	}
+	_, err = apiCfg.db.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+		UserID: user.Id,
+		Name: "expired",
+		KeyHash: auth.HashToken(expiredKey),
+		Prefix: prefix,
+		Scopes: []string{auth.ScopeChirpsWrite},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("could not store api key: %v", err)
+	}
+
+	chirp := returnValueChirps{}
+	if code := doJSON(t, "POST", server.URL+"/api/chirps", "ApiKey "+writer.Key, parametersChirps{Body: "beep"}, &chirp); code != http.StatusCreated {
+		t.Fatalf("expected 201 creating chirp with an api key, got %d", code)
+	}
+	if chirp.UserID != user.Id {
+		t.Errorf("expected the chirp to belong to %s, got %s", user.Id, chirp.UserID)
+	}
+	pastExpiry := time.Now().Add(-time.Hour)
+
+	cases := []struct{
+		name string
+		method string
+		path string
+		authorization string
+		payload interface{}
+		expectedStatus int
+	}{
+		{name: "unknown key", method: "POST", path: "/api/chirps", authorization: "ApiKey " + auth.APIKeyPrefix + "nope", payload: parametersChirps{Body: "beep"}, expectedStatus: http.StatusUnauthorized},
+		{name: "revoked key", method: "POST", path: "/api/chirps", authorization: "ApiKey " + revoked.Key, payload: parametersChirps{Body: "beep"}, expectedStatus: http.StatusUnauthorized},
+		{name: "expired key", method: "POST", path: "/api/chirps", authorization: "ApiKey " + expiredKey, payload: parametersChirps{Body: "beep"}, expectedStatus: http.StatusUnauthorized},
+		{name: "key missing scope", method: "POST", path: "/api/chirps", authorization: "ApiKey " + reader.Key, payload: parametersChirps{Body: "beep"}, expectedStatus: http.StatusForbidden},
+		{name: "key deletes chirp", method: "DELETE", path: "/api/chirps/" + chirp.Id.String(), authorization: "ApiKey " + writer.Key, expectedStatus: http.StatusNoContent},
+		{name: "key cannot grant more than it has", method: "POST", path: "/api/users/me/api-keys", authorization: "ApiKey " + writer.Key, payload: parametersAPIKey{Name: "child", Scopes: []string{auth.ScopeChirpsWrite}}, expectedStatus: http.StatusForbidden},
+		{name: "key cannot make keys", method: "POST", path: "/api/users/me/api-keys", authorization: "ApiKey " + manager.Key, payload: parametersAPIKey{Name: "child", Scopes: []string{auth.ScopeChirpsWrite}}, expectedStatus: http.StatusForbidden},
+		{name: "scope the token lacks", method: "POST", path: "/api/users/me/api-keys", authorization: "Bearer " + user.Token, payload: parametersAPIKey{Name: "admin", Scopes: []string{"admin:all"}}, expectedStatus: http.StatusForbidden},
+		{name: "expiry in the past", method: "POST", path: "/api/users/me/api-keys", authorization: "Bearer " + user.Token, payload: parametersAPIKey{Name: "late", Scopes: []string{auth.ScopeUsersRead}, ExpiresAt: &pastExpiry}, expectedStatus: http.StatusBadRequest},
+		{name: "other user's key", method: "DELETE", path: "/api/users/me/api-keys/" + writer.Id.String(), authorization: "Bearer " + createAndLogin(t, server.URL, "other@example.com").Token, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		if code := doJSON(t, c.method, server.URL+c.path, c.authorization, c.payload, nil); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+
+	// Listing never shows the keys themselves.
+	listed := []returnValueAPIKey{}
+	if code := doJSON(t, "GET", keysURL, "ApiKey "+writer.Key, nil, &listed); code != http.StatusOK {
+		t.Fatalf("expected 200 listing api keys, got %d", code)
+	}
+	if len(listed) != 5 {
+		t.Fatalf("expected 5 api keys, got %d", len(listed))
+	}
+	for _, apiKey := range listed {
+		if apiKey.Key != "" {
+			t.Errorf("expected no secret for %s", apiKey.Name)
+		}
+		if apiKey.Id == writer.Id && apiKey.LastUsedAt == nil {
+			t.Errorf("expected %s to have been used", apiKey.Name)
+		}
+		if apiKey.Id == revoked.Id && apiKey.RevokedAt == nil {
+			t.Errorf("expected %s to be revoked", apiKey.Name)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	cfg, server := newTestServer(t)
+	laptop := createAndLogin(t, server.URL, "jesse@example.com")
+	login := func() returnValueUsers {
+		t.Helper()
+		user := returnValueUsers{}
+		if code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "jesse@example.com", Password: "hunter2"}, &user); code != http.StatusOK {
+			t.Fatalf("expected 200 logging in, got %d", code)
+		}
+		return user
+	}
+	phone := login()
+	tablet := login()
+	sessionID := func(user returnValueUsers) string {
+		t.Helper()
+		principal, err := auth.ValidateJWT(context.Background(), user.Token, cfg.keyring, nil)
+		if err != nil || principal.SessionID == uuid.Nil {
+			t.Fatalf("expected a session in the access token, got %+v (%v)", principal, err)
+		}
+		return principal.SessionID.String()
+	}
+	refresh := func(refreshToken string) int {
+		return doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+refreshToken, nil, nil)
+	}
+
+	// Refreshing rotates the token but stays in the same session.
+	rotated := returnValueRefreshToken{}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+phone.RefreshToken, nil, &rotated); code != http.StatusOK {
+		t.Fatalf("expected 200 refreshing, got %d", code)
+	}
+	sessions := []returnValueSession{}
+	if code := doJSON(t, "GET", server.URL+"/api/sessions", "Bearer "+laptop.Token, nil, &sessions); code != http.StatusOK {
+		t.Fatalf("expected 200 listing sessions, got %d", code)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %d", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.Current != (session.Id.String() == sessionID(laptop)) || session.UserAgent == "" || session.IpAddress == "" {
+			t.Errorf("unexpected session %+v", session)
+		}
+	}
+
+	other := createAndLogin(t, server.URL, "skyler@example.com")
+	cases := []struct{
+		name string
+		authorization string
+		sessionID string
+		expectedStatus int
+	}{
+		{name: "someone else's session", authorization: "Bearer " + other.Token, sessionID: sessionID(tablet), expectedStatus: http.StatusNotFound},
+		{name: "own session", authorization: "Bearer " + laptop.Token, sessionID: sessionID(tablet), expectedStatus: http.StatusNoContent},
+		{name: "already revoked", authorization: "Bearer " + laptop.Token, sessionID: sessionID(tablet), expectedStatus: http.StatusNotFound},
+		{name: "invalid id", authorization: "Bearer " + laptop.Token, sessionID: "tablet", expectedStatus: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if code := doJSON(t, "DELETE", server.URL+"/api/sessions/"+c.sessionID, c.authorization, nil, nil); code != c.expectedStatus {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, c.expectedStatus, code)
+		}
+	}
+	if code := refresh(tablet.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked session not to refresh, got %d", code)
+	}
+
+	// Changing the password keeps only the session it was changed from.
+	params := parametersUsers{Email: "jesse@example.com", Password: "new-password"}
+	updated := returnValueUsers{}
+	if code := doJSON(t, "PUT", server.URL+"/api/users", "Bearer "+laptop.Token, params, &updated); code != http.StatusOK {
+		t.Fatalf("expected 200 changing password, got %d", code)
+	}
+	if sessionID(updated) != sessionID(laptop) {
+		t.Errorf("expected a new access token for the current session")
+	}
+	if code := refresh(rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected other sessions to be signed out by a password change, got %d", code)
+	}
+	laptopRefreshed := returnValueRefreshToken{}
+	if code := doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+laptop.RefreshToken, nil, &laptopRefreshed); code != http.StatusOK {
+		t.Fatalf("expected the current session to survive a password change, got %d", code)
+	}
+
+	if code := doJSON(t, "POST", server.URL+"/api/logout-all", "Bearer "+updated.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 logging out everywhere, got %d", code)
+	}
+	if code := refresh(laptopRefreshed.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected every session to be signed out, got %d", code)
+	}
+	if code := refresh(other.RefreshToken); code != http.StatusOK {
+		t.Errorf("expected other users to stay signed in, got %d", code)
+	}
+}
+
+// touchFailingStore is a store that can not record when sessions and api keys
+// were last used.
+type touchFailingStore struct {
+	database.Store
+}
+
+func (touchFailingStore) TouchSession(ctx context.Context, familyID uuid.UUID) error {
+	return errors.New("touch failed")
+}
+
+func (touchFailingStore) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	return errors.New("touch failed")
+}
+
+func TestTouchFailures(t *testing.T) {
+	apiCfg, server := newTestServer(t)
+	user := createAndLogin(t, server.URL, "walt@example.com")
+	apiKey := returnValueAPIKey{}
+	if code := doJSON(t, "POST", server.URL+"/api/users/me/api-keys", "Bearer "+user.Token, parametersAPIKey{Name: "writer", Scopes: []string{auth.ScopeChirpsWrite}}, &apiKey); code != http.StatusCreated {
+		t.Fatalf("expected 201 creating api key, got %d", code)
+	}
+	apiCfg.db = touchFailingStore{Store: apiCfg.db}
+
+	cases := []struct{
+		name string
+		authorization string
+	}{
+		{name: "access token", authorization: "Bearer " + user.Token},
+		{name: "api key", authorization: "ApiKey " + apiKey.Key},
+	}
+
+	for _, c := range cases {
+		if code := doJSON(t, "POST", server.URL+"/api/chirps", c.authorization, parametersChirps{Body: "still here"}, nil); code != http.StatusCreated {
+			t.Errorf("Test failed for %s, expected %d but got %d", c.name, http.StatusCreated, code)
+		}
+	}
+}
+
+func TestAccessTokenRevocation(t *testing.T) {
+	cfg, server := newTestServer(t)
+	cfg.config.AdminAPIKey = "test-admin-key"
+	laptop := createAndLogin(t, server.URL, "gus@example.com")
+	phone := returnValueUsers{}
+	if code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "gus@example.com", Password: "hunter2"}, &phone); code != http.StatusOK {
+		t.Fatalf("expected 200 logging in, got %d", code)
+	}
+	subscription := func(token string) int {
+		return doJSON(t, "GET", server.URL+"/api/users/me/subscription", "Bearer "+token, nil, nil)
+	}
+	refresh := func(refreshToken string) int {
+		return doJSON(t, "POST", server.URL+"/api/refresh", "Bearer "+refreshToken, nil, nil)
+	}
+
+	if code := doJSON(t, "POST", server.URL+"/api/logout", "Bearer "+laptop.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 logging out, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/api/logout", "Bearer "+laptop.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 logging out twice, got %d", code)
+	}
+	if code := subscription(laptop.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected a logged out access token to be rejected, got %d", code)
+	}
+	if code := refresh(laptop.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected a logged out session not to refresh, got %d", code)
+	}
+	if code := subscription(phone.Token); code != http.StatusOK {
+		t.Errorf("expected other sessions to stay signed in, got %d", code)
+	}
+
+	// iat has second precision, so tokens from the second a user is signed
+	// out everywhere in are let through.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	revokeURL := server.URL + "/admin/users/" + laptop.Id.String() + "/revoke-tokens"
+	if code := doJSON(t, "POST", revokeURL, "ApiKey test-admin-key", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking user tokens, got %d", code)
+	}
+	if code := doJSON(t, "POST", server.URL+"/admin/users/"+uuid.NewString()+"/revoke-tokens", "ApiKey test-admin-key", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 revoking tokens of an unknown user, got %d", code)
+	}
+	if code := subscription(phone.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected every access token to be revoked, got %d", code)
+	}
+	if code := refresh(phone.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected every session to be revoked, got %d", code)
+	}
+	fresh := returnValueUsers{}
+	if code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "gus@example.com", Password: "hunter2"}, &fresh); code != http.StatusOK {
+		t.Fatalf("expected 200 logging in again, got %d", code)
+	}
+	if code := subscription(fresh.Token); code != http.StatusOK {
+		t.Errorf("expected tokens issued afterwards to work, got %d", code)
+	}
+
+	// Only entries for tokens that have expired are swept.
+	ctx := context.Background()
+	expired := database.CreateRevokedAccessTokenParams{Jti: "expired", UserID: laptop.Id, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := cfg.db.CreateRevokedAccessToken(ctx, expired); err != nil {
+		t.Fatalf("could not revoke token: %v", err)
+	}
+	if err := cfg.sweepRevokedAccessTokens(ctx); err != nil {
+		t.Fatalf("could not sweep: %v", err)
+	}
+	laptopPrincipal, err := auth.ValidateJWT(ctx, laptop.Token, cfg.keyring, nil)
+	if err != nil {
+		t.Fatalf("could not read token: %v", err)
+	}
+	for jti, expectedRevoked := range map[string]bool{"expired": false, laptopPrincipal.TokenID: true} {
+		if revoked, err := cfg.db.IsAccessTokenRevoked(ctx, jti); err != nil || revoked != expectedRevoked {
+			t.Errorf("Test failed for %s, expected revoked %v but got %v (%v)", jti, expectedRevoked, revoked, err)
+		}
+	}
+}
+
+func TestAccessTokenRevocationOutsideUTC(t *testing.T) {
+	for _, zone := range outsideUTC {
+		setLocalTimeZone(t, zone)
+		cfg, server := newTestServer(t)
+		stale := createAndLogin(t, server.URL, "lydia@example.com")
+		subscription := func(token string) int {
+			return doJSON(t, "GET", server.URL+"/api/users/me/subscription", "Bearer "+token, nil, nil)
+		}
+
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		if code := doJSON(t, "POST", server.URL+"/api/logout-all", "Bearer "+stale.Token, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("Test failed for %s, expected 204 logging out everywhere but got %d", zone, code)
+		}
+		if code := subscription(stale.Token); code != http.StatusUnauthorized {
+			t.Errorf("Test failed for %s, expected a revoked token to be rejected but got %d", zone, code)
+		}
+
+		fresh := returnValueUsers{}
+		if code := doJSON(t, "POST", server.URL+"/api/login", "", parametersUsers{Email: "lydia@example.com", Password: "hunter2"}, &fresh); code != http.StatusOK {
+			t.Fatalf("Test failed for %s, expected 200 logging in again but got %d", zone, code)
+		}
+		if code := subscription(fresh.Token); code != http.StatusOK {
+			t.Errorf("Test failed for %s, expected a token issued afterwards to work but got %d", zone, code)
+		}
+
+		// The sweep only forgets revocations of tokens that have expired.
+		if code := doJSON(t, "POST", server.URL+"/api/logout", "Bearer "+fresh.Token, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("Test failed for %s, expected 204 logging out but got %d", zone, code)
+		}
+		if err := cfg.sweepRevokedAccessTokens(context.Background()); err != nil {
+			t.Fatalf("Test failed for %s, could not sweep: %v", zone, err)
+		}
+		cfg.revocations = newRevocationCache(cfg.db, cfg.config.RevocationCacheTTL)
+		if code := subscription(fresh.Token); code != http.StatusUnauthorized {
+			t.Errorf("Test failed for %s, expected a logged out token to stay rejected after a sweep but got %d", zone, code)
+		}
+	}
+}
+
+func TestChirpThreads(t *testing.T) {
+	_, server := newTestServer(t)
+
+	author := createAndLogin(t, server.URL, "author@example.com")
+	other := createAndLogin(t, server.URL, "other@example.com")
+
+	post := func(token, body string, inReplyTo *uuid.UUID) returnValueChirps {
+		t.Helper()
+		chirp := returnValueChirps{}
+		params := parametersChirps{Body: body, InReplyTo: inReplyTo}
+		if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+token, params, &chirp); code != http.StatusCreated {
+			t.Fatalf("expected 201 posting %q, got %d", body, code)
+		}
+		return chirp
+	}
+	root := post(author.Token, "root", nil)
+	first := post(other.Token, "first reply", &root.Id)
+	second := post(author.Token, "second reply", &root.Id)
+	nested := post(author.Token, "nested reply", &first.Id)
+
+	if first.InReplyTo == nil || *first.InReplyTo != root.Id {
+		t.Errorf("expected reply to point at root, got: %+v", first.InReplyTo)
+	}
+	missing := uuid.New()
+	if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+author.Token, parametersChirps{Body: "hello?", InReplyTo: &missing}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 replying to a missing chirp, got %d", code)
+	}
+
+	fetched := returnValueChirps{}
+	if code := doJSON(t, "GET", server.URL+"/api/chirps/"+root.Id.String(), "", nil, &fetched); code != http.StatusOK {
+		t.Fatalf("expected 200 getting root, got %d", code)
+	}
+	if fetched.ReplyCount != 2 {
+		t.Errorf("expected root to have 2 replies, got %d", fetched.ReplyCount)
+	}
+
+	// Any chirp in the conversation leads to the whole thread.
+	thread := returnValueThreadChirp{}
+	if code := doJSON(t, "GET", server.URL+"/api/chirps/"+nested.Id.String()+"/thread", "", nil, &thread); code != http.StatusOK {
+		t.Fatalf("expected 200 getting thread, got %d", code)
+	}
+	if thread.Id != root.Id || thread.Depth != 0 || len(thread.Replies) != 2 {
+		t.Fatalf("expected thread rooted at root with 2 replies, got: %+v", thread)
+	}
+	if thread.Replies[0].Id != first.Id || thread.Replies[1].Id != second.Id {
+		t.Errorf("expected replies oldest first, got: %+v", thread.Replies)
+	}
+	if len(thread.Replies[0].Replies) != 1 || thread.Replies[0].Replies[0].Depth != 2 {
+		t.Errorf("expected nested reply at depth 2, got: %+v", thread.Replies[0].Replies)
+	}
+
+	// Deleting a chirp with replies leaves a tombstone; one without replies
+	// disappears from the thread.
+	if code := doJSON(t, "DELETE", server.URL+"/api/chirps/"+first.Id.String(), "Bearer "+other.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting reply, got %d", code)
+	}
+	if code := doJSON(t, "DELETE", server.URL+"/api/chirps/"+second.Id.String(), "Bearer "+author.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting reply, got %d", code)
+	}
+	thread = returnValueThreadChirp{}
+	if code := doJSON(t, "GET", server.URL+"/api/chirps/"+root.Id.String()+"/thread", "", nil, &thread); code != http.StatusOK {
+		t.Fatalf("expected 200 getting thread, got %d", code)
+	}
+	if thread.ReplyCount != 0 || len(thread.Replies) != 1 {
+		t.Fatalf("expected only the tombstone under root, got: %+v", thread)
+	}
+	tombstone := thread.Replies[0]
+	if tombstone.Id != first.Id || !tombstone.Deleted || tombstone.Body != "" {
+		t.Errorf("expected a tombstone for the deleted reply, got: %+v", tombstone)
+	}
+	if len(tombstone.Replies) != 1 || tombstone.Replies[0].Id != nested.Id {
+		t.Errorf("expected the nested reply to survive, got: %+v", tombstone.Replies)
+	}
+
+	cases := []struct{
+		name string
+		chirpID uuid.UUID
+		expectedCode int
+	}{
+		{
+			name: "tombstone with replies",
+			chirpID: first.Id,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "deleted without replies",
+			chirpID: second.Id,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "missing",
+			chirpID: missing,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, c := range cases {
+		if code := doJSON(t, "GET", server.URL+"/api/chirps/"+c.chirpID.String()+"/thread", "", nil, nil); code != c.expectedCode {
+			t.Errorf("Test failed for %s: expected %d, got %d", c.name, c.expectedCode, code)
+		}
+	}
+	if code := doJSON(t, "GET", server.URL+"/api/chirps/"+first.Id.String(), "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected deleted chirp to be gone, got %d", code)
+	}
+}
+
+func TestChirpLikes(t *testing.T) {
+	_, server := newTestServer(t)
+
+	author := createAndLogin(t, server.URL, "author@example.com")
+	chirp := returnValueChirps{}
+	if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+author.Token, parametersChirps{Body: "like me"}, &chirp); code != http.StatusCreated {
+		t.Fatalf("expected 201 creating chirp, got %d", code)
+	}
+	likeURL := server.URL + "/api/chirps/" + chirp.Id.String() + "/like"
+
+	likers := []returnValueUsers{}
+	for i := range 5 {
+		likers = append(likers, createAndLogin(t, server.URL, fmt.Sprintf("liker%d@example.com", i)))
+	}
+	// Every liker likes twice at the same time; each like only counts once.
+	var wg sync.WaitGroup
+	codes := make(chan int, 2*len(likers))
+	for _, liker := range likers {
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- doJSON(t, "POST", likeURL, "Bearer "+liker.Token, nil, nil)
+			}()
+		}
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected 200 liking chirp, got %d", code)
+		}
+	}
+
+	notLiked, liked := false, true
+	cases := []struct{
+		name string
+		authorization string
+		expectedLikedByMe *bool
+	}{
+		{
+			name: "anonymous",
+			authorization: "",
+			expectedLikedByMe: nil,
+		},
+		{
+			name: "author",
+			authorization: "Bearer " + author.Token,
+			expectedLikedByMe: &notLiked,
+		},
+		{
+			name: "liker",
+			authorization: "Bearer " + likers[0].Token,
+			expectedLikedByMe: &liked,
+		},
+	}
+	for _, c := range cases {
+		fetched := returnValueChirps{}
+		if code := doJSON(t, "GET", server.URL+"/api/chirps/"+chirp.Id.String(), c.authorization, nil, &fetched); code != http.StatusOK {
+			t.Fatalf("Test failed for %s: expected 200 getting chirp, got %d", c.name, code)
+		}
+		if fetched.LikeCount != int64(len(likers)) {
+			t.Errorf("Test failed for %s: expected %d likes, got %d", c.name, len(likers), fetched.LikeCount)
+		}
+		if (fetched.LikedByMe == nil) != (c.expectedLikedByMe == nil) || (fetched.LikedByMe != nil && *fetched.LikedByMe != *c.expectedLikedByMe) {
+			t.Errorf("Test failed for %s: expected liked_by_me %v, got %v", c.name, c.expectedLikedByMe, fetched.LikedByMe)
+		}
+	}
+
+	likes := []returnValueChirps{}
+	if code := doJSON(t, "GET", server.URL+"/api/users/"+likers[0].Id.String()+"/likes", "", nil, &likes); code != http.StatusOK {
+		t.Fatalf("expected 200 listing likes, got %d", code)
+	}
+	if len(likes) != 1 || likes[0].Id != chirp.Id {
+		t.Errorf("expected the liked chirp, got: %+v", likes)
+	}
+
+	// Unliking twice is as good as once.
+	for range 2 {
+		unliked := returnValueChirps{}
+		if code := doJSON(t, "DELETE", likeURL, "Bearer "+likers[0].Token, nil, &unliked); code != http.StatusOK {
+			t.Fatalf("expected 200 unliking chirp, got %d", code)
+		}
+		if unliked.LikeCount != int64(len(likers)-1) || unliked.LikedByMe == nil || *unliked.LikedByMe {
+			t.Errorf("expected like to be taken back, got: %+v", unliked)
+		}
+	}
+
+	// A deleted chirp drops out of everyone's likes and can not be liked.
+	if code := doJSON(t, "DELETE", server.URL+"/api/chirps/"+chirp.Id.String(), "Bearer "+author.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting chirp, got %d", code)
+	}
+	likes = []returnValueChirps{}
+	if code := doJSON(t, "GET", server.URL+"/api/users/"+likers[1].Id.String()+"/likes", "", nil, &likes); code != http.StatusOK {
+		t.Fatalf("expected 200 listing likes, got %d", code)
+	}
+	if len(likes) != 0 {
+		t.Errorf("expected deleted chirp to be left out, got: %+v", likes)
+	}
+	if code := doJSON(t, "POST", likeURL, "Bearer "+likers[1].Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 liking deleted chirp, got %d", code)
+	}
+	if code := doJSON(t, "GET", server.URL+"/api/users/"+uuid.NewString()+"/likes", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 listing likes of missing user, got %d", code)
+	}
+}
+
+func TestFollowsAndTimeline(t *testing.T) {
+	_, server := newTestServer(t)
+
+	reader := createAndLogin(t, server.URL, "reader@example.com")
+	followed := createAndLogin(t, server.URL, "followed@example.com")
+	muted := createAndLogin(t, server.URL, "muted@example.com")
+	blocker := createAndLogin(t, server.URL, "blocker@example.com")
+	stranger := createAndLogin(t, server.URL, "stranger@example.com")
+	usersURL := server.URL + "/api/users/"
+
+	for _, user := range []returnValueUsers{followed, muted, blocker} {
+		if code := doJSON(t, "POST", usersURL+user.Id.String()+"/follow", "Bearer "+reader.Token, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("expected 204 following %s, got %d", user.Email, code)
+		}
+	}
+	// Following again changes nothing.
+	if code := doJSON(t, "POST", usersURL+followed.Id.String()+"/follow", "Bearer "+reader.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("expected 204 following twice, got %d", code)
+	}
+
+	post := func(user returnValueUsers, body string) returnValueChirps {
+		t.Helper()
+		chirp := returnValueChirps{}
+		if code := doJSON(t, "POST", server.URL+"/api/chirps", "Bearer "+user.Token, parametersChirps{Body: body}, &chirp); code != http.StatusCreated {
+			t.Fatalf("expected 201 posting %q, got %d", body, code)
+		}
+		return chirp
+	}
+	var expected []uuid.UUID
+	for i := range 3 {
+		expected = append(expected, post(followed, fmt.Sprintf("chirp %d", i)).Id)
+	}
+	post(muted, "you won't see this")
+	post(blocker, "nor this")
+	post(stranger, "not followed")
+
+	if code := doJSON(t, "POST", usersURL+muted.Id.String()+"/mute", "Bearer "+reader.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 muting, got %d", code)
+	}
+	if code := doJSON(t, "POST", usersURL+reader.Id.String()+"/block", "Bearer "+blocker.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204 blocking, got %d", code)
+	}
+
+	// Page through the timeline two chirps at a time, newest first.
+	var got []uuid.UUID
+	timelineURL := server.URL + "/api/timeline?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("timeline did not end")
+		}
+		page := returnValueChirpsPage{}
+		if code := doJSON(t, "GET", timelineURL, "Bearer "+reader.Token, nil, &page); code != http.StatusOK {
+			t.Fatalf("expected 200 getting timeline, got %d", code)
+		}
+		for _, chirp := range page.Chirps {
+			got = append(got, chirp.Id)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		timelineURL = server.URL + "/api/timeline?limit=2&cursor=" + *page.NextCursor
+	}
+	slices.Reverse(expected)
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected only the followed user's chirps newest first, got: %v", got)
+	}
+
+	followers := returnValueFollowList{}
+	if code := doJSON(t, "GET", usersURL+followed.Id.String()+"/followers", "", nil, &followers); code != http.StatusOK {
+		t.Fatalf("expected 200 listing followers, got %d", code)
+	}
+	if followers.Count != 1 || followers.Users[0].UserID != reader.Id {
+		t.Errorf("expected the reader as the only follower, got: %+v", followers)
+	}
+	// The block ended the reader's follow of the blocker.
+	following := returnValueFollowList{}
+	if code := doJSON(t, "GET", usersURL+reader.Id.String()+"/following", "", nil, &following); code != http.StatusOK {
+		t.Fatalf("expected 200 listing following, got %d", code)
+	}
+	if following.Count != 2 {
+		t.Errorf("expected the reader to follow 2 users, got: %+v", following)
+	}
+
+	cases := []struct{
+		name string
+		method string
+		url string
+		authorization string
+		expectedCode int
+	}{
+		{
+			name: "follow without token",
+			method: "POST",
+			url: usersURL + followed.Id.String() + "/follow",
+			authorization: "",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "follow yourself",
+			method: "POST",
+			url: usersURL + reader.Id.String() + "/follow",
+			authorization: "Bearer " + reader.Token,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "follow missing user",
+			method: "POST",
+			url: usersURL + uuid.NewString() + "/follow",
+			authorization: "Bearer " + reader.Token,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "follow someone who blocked you",
+			method: "POST",
+			url: usersURL + blocker.Id.String() + "/follow",
+			authorization: "Bearer " + reader.Token,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "timeline without token",
+			method: "GET",
+			url: server.URL + "/api/timeline",
+			authorization: "",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "timeline with bad cursor",
+			method: "GET",
+			url: server.URL + "/api/timeline?cursor=nope",
+			authorization: "Bearer " + reader.Token,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "unfollow",
+			method: "DELETE",
+			url: usersURL + followed.Id.String() + "/follow",
+			authorization: "Bearer " + reader.Token,
+			expectedCode: http.StatusNoContent,
+		},
+	}
+	for _, c := range cases {
+		if code := doJSON(t, c.method, c.url, c.authorization, nil, nil); code != c.expectedCode {
+			t.Errorf("Test failed for %s: expected %d, got %d", c.name, c.expectedCode, code)
+		}
+	}
+
+	page := returnValueChirpsPage{}
+	if code := doJSON(t, "GET", server.URL+"/api/timeline", "Bearer "+reader.Token, nil, &page); code != http.StatusOK {
+		t.Fatalf("expected 200 getting timeline, got %d", code)
+	}
+	if len(page.Chirps) != 0 {
+		t.Errorf("expected an empty timeline after unfollowing, got: %+v", page.Chirps)
+	}
+}
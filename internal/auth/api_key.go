@@ -1,15 +1,41 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 )
 
+var ErrMalformedAPIKeyHeader = errors.New("authorization header must be of the form \"ApiKey <key>\"")
+var ErrCouldNotMakeAPIKey = errors.New("could not make new api key")
+
+// APIKeyPrefix starts every personal API key, which tells them apart from
+// the shared keys the admin and the payment provider use.
+const APIKeyPrefix = "chirpy_"
+
+// apiKeyPrefixLength is how much of a key is kept in the clear so users can
+// tell their keys apart.
+const apiKeyPrefixLength = len(APIKeyPrefix) + 6
+
 func GetAPIKey(headers http.Header) (string, error) {
 	apiKey := headers.Get("Authorization")
 	if len(apiKey) == 0 {
 		return "", ErrAuthorizationHeaderDoesNotExist
 	}
-	apiKey = strings.Split(apiKey, " ")[1]
+	apiKey, ok := strings.CutPrefix(apiKey, "ApiKey ")
+	if !ok || apiKey == "" {
+		return "", ErrMalformedAPIKeyHeader
+	}
 	return apiKey, nil
-}
\ No newline at end of file
+}
+
+// MakeAPIKey returns a new personal API key and the prefix of it that may be
+// stored and shown. Only the HashToken of the key itself is stored.
+func MakeAPIKey() (key string, prefix string, err error) {
+	random, err := MakeRefreshToken()
+	if err != nil {
+		return "", "", ErrCouldNotMakeAPIKey
+	}
+	key = APIKeyPrefix + random
+	return key, key[:apiKeyPrefixLength], nil
+}
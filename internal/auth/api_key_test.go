@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetAPIKey(t *testing.T) {
+	cases := []struct{
+		name string
+		header http.Header
+		expectedAPIKey string
+		expectedError error
+	}{
+		{name: "api key", header: http.Header{"Authorization": []string{"ApiKey chirpy_abc"}}, expectedAPIKey: "chirpy_abc", expectedError: nil},
+		{name: "no header", header: http.Header{}, expectedAPIKey: "", expectedError: ErrAuthorizationHeaderDoesNotExist},
+		{name: "no scheme", header: http.Header{"Authorization": []string{"chirpy_abc"}}, expectedAPIKey: "", expectedError: ErrMalformedAPIKeyHeader},
+		{name: "bearer scheme", header: http.Header{"Authorization": []string{"Bearer token"}}, expectedAPIKey: "", expectedError: ErrMalformedAPIKeyHeader},
+		{name: "empty key", header: http.Header{"Authorization": []string{"ApiKey "}}, expectedAPIKey: "", expectedError: ErrMalformedAPIKeyHeader},
+	}
+
+	for _, c := range cases {
+		apiKey, err := GetAPIKey(c.header)
+		if err != c.expectedError || apiKey != c.expectedAPIKey {
+			t.Errorf("Test failed for %s, expected %q and %v but got %q and %v", c.name, c.expectedAPIKey, c.expectedError, apiKey, err)
+		}
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("could not make api key: %v", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || !strings.HasPrefix(key, prefix) || len(prefix) >= len(key) {
+		t.Errorf("expected %q to start with %s and %q", key, APIKeyPrefix, prefix)
+	}
+	other, _, err := MakeAPIKey()
+	if err != nil || other == key {
+		t.Errorf("expected two different keys, got %q twice (%v)", key, err)
+	}
+}
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,37 +14,117 @@ var ErrInvalidOrExpiredToken = errors.New("token is invalid or expired")
 var ErrRetrievingUserIDFromToken = errors.New("error error retrieving user id from token")
 var ErrParsingUUIDFromString = errors.New("error parsing uuid id from string")
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer: "Chirpy",
-		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
-		Subject: userID.String(),
-	})
-	tokString, err := token.SignedString([]byte(tokenSecret))
+// Access tokens and two-factor challenge tokens are signed with the same
+// keys, so the issuer is what keeps one from being used as the other.
+const (
+	accessTokenIssuer = "Chirpy"
+	challengeTokenIssuer = "Chirpy-2FA"
+)
+
+// claims are the registered claims plus the session, the roles and the space
+// separated scope of RFC 8693.
+type claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	Scope string `json:"scope,omitempty"`
+}
+
+func MakeJWT(principal Principal, keyring *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(accessTokenIssuer, principal, keyring, expiresIn)
+}
+
+// ValidateJWT checks an access token and, unless revocations is nil, that
+// it has not been revoked since it was issued.
+func ValidateJWT(ctx context.Context, tokenString string, keyring *Keyring, revocations Revocations) (Principal, error) {
+	principal, issuedAt, err := validateJWT(accessTokenIssuer, tokenString, keyring)
+	if err != nil {
+		return Principal{}, err
+	}
+	if revocations != nil {
+		if err := checkRevoked(ctx, revocations, principal, issuedAt); err != nil {
+			return Principal{}, err
+		}
+	}
+	// Tokens issued before roles existed carry neither claim and get what
+	// every user had then.
+	if principal.Roles == nil && principal.Scopes == nil {
+		principal.Roles = []string{RoleUser}
+		principal.Scopes = DefaultScopes
+	}
+	return principal, nil
+}
+
+// MakeChallengeJWT issues a token proving the password step of a two-factor
+// login succeeded. ValidateJWT rejects it.
+func MakeChallengeJWT(userID uuid.UUID, keyring *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(challengeTokenIssuer, Principal{UserID: userID}, keyring, expiresIn)
+}
+
+func ValidateChallengeJWT(tokenString string, keyring *Keyring) (uuid.UUID, error) {
+	principal, _, err := validateJWT(challengeTokenIssuer, tokenString, keyring)
+	return principal.UserID, err
+}
+
+func makeJWT(issuer string, principal Principal, keyring *Keyring, expiresIn time.Duration) (string, error) {
+	tokenClaims := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: issuer,
+			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn).UTC()),
+			Subject: principal.UserID.String(),
+			ID: uuid.NewString(),
+		},
+		Roles: principal.Roles,
+		Scope: strings.Join(principal.Scopes, " "),
+	}
+	if principal.SessionID != uuid.Nil {
+		tokenClaims.SessionID = principal.SessionID.String()
+	}
+	token := jwt.NewWithClaims(keyring.signing.method, tokenClaims)
+	token.Header["kid"] = keyring.signing.ID
+	tokString, err := token.SignedString(keyring.signing.private)
 	if err != nil {
 		return "", errors.New("error signing token")
 	}
 	return tokString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// validateJWT also returns when the token was issued, or the zero time for
+// tokens without an iat claim.
+func validateJWT(issuer, tokenString string, keyring *Keyring) (Principal, time.Time, error) {
+	tokenClaims := &claims{}
+	_, err := jwt.ParseWithClaims(tokenString, tokenClaims, keyring.verificationKey, jwt.WithIssuer(issuer))
 	if err != nil {
-		return uuid.Nil, ErrInvalidOrExpiredToken
+		return Principal{}, time.Time{}, ErrInvalidOrExpiredToken
 	}
 
-	userString, err := token.Claims.GetSubject()
+	userString, err := tokenClaims.GetSubject()
 	if err != nil {
-		return uuid.Nil, ErrRetrievingUserIDFromToken
+		return Principal{}, time.Time{}, ErrRetrievingUserIDFromToken
 	}
 
 	userUUID, err := uuid.Parse(userString)
 	if err != nil {
-		return uuid.Nil, ErrParsingUUIDFromString
+		return Principal{}, time.Time{}, ErrParsingUUIDFromString
 	}
 
-	return userUUID, nil
-}
\ No newline at end of file
+	principal := Principal{UserID: userUUID, Roles: tokenClaims.Roles, TokenID: tokenClaims.ID}
+	if tokenClaims.SessionID != "" {
+		principal.SessionID, err = uuid.Parse(tokenClaims.SessionID)
+		if err != nil {
+			return Principal{}, time.Time{}, ErrParsingUUIDFromString
+		}
+	}
+	if tokenClaims.Scope != "" {
+		principal.Scopes = strings.Fields(tokenClaims.Scope)
+	}
+	if tokenClaims.ExpiresAt != nil {
+		principal.ExpiresAt = tokenClaims.ExpiresAt.Time
+	}
+	issuedAt := time.Time{}
+	if tokenClaims.IssuedAt != nil {
+		issuedAt = tokenClaims.IssuedAt.Time
+	}
+	return principal, issuedAt, nil
+}
@@ -1,48 +1,65 @@
 package auth
 
 import (
+	"context"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// testKeyring returns a keyring holding a single new Ed25519 key.
+func testKeyring(t *testing.T, id string) *Keyring {
+	t.Helper()
+	key, err := GenerateKey(id)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	keyring, err := NewKeyring("", []Key{key}, "")
+	if err != nil {
+		t.Fatalf("could not make keyring: %v", err)
+	}
+	return keyring
+}
+
 func TestJWTValidation(t *testing.T) {
 	userIDs := []uuid.UUID{uuid.New(), uuid.New()}
 
-	var tokenSecret = "secret"
+	keyring := testKeyring(t, "current")
+	otherKeyring := testKeyring(t, "current")
 
 	cases := []struct{
 		userID uuid.UUID
-		tokenSecret string
+		keyring *Keyring
 		expiresIn time.Duration
 		expectedID uuid.UUID
 		expectedError error
 	}{
 		{
 			userID: userIDs[0],
-			tokenSecret: "secret",
+			keyring: keyring,
 			expiresIn: time.Hour,
 			expectedID: userIDs[0],
 			expectedError: nil,
 		},
 		{
 			userID: userIDs[1],
-			tokenSecret: "secret",
+			keyring: keyring,
 			expiresIn: time.Hour,
 			expectedID: userIDs[1],
 			expectedError: nil,
 		},
 		{
 			userID: userIDs[0],
-			tokenSecret: "secret",
+			keyring: keyring,
 			expiresIn: time.Nanosecond,
 			expectedID: uuid.UUID{},
 			expectedError: ErrInvalidOrExpiredToken,
 		},
 		{
 			userID: userIDs[0],
-			tokenSecret: "not_secret",
+			keyring: otherKeyring,
 			expiresIn: time.Hour,
 			expectedID: uuid.UUID{},
 			expectedError: ErrInvalidOrExpiredToken,
@@ -51,7 +68,7 @@ func TestJWTValidation(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		tokString, err := MakeJWT(c.userID, c.tokenSecret, c.expiresIn)
+		tokString, err := MakeJWT(Principal{UserID: c.userID}, c.keyring, c.expiresIn)
 		if err != nil {
 			t.Errorf("Test failed due to signing of a token failing: %v", err)
 			t.Fail()
@@ -59,10 +76,123 @@ func TestJWTValidation(t *testing.T) {
 		// Sleep for just longer than the expiry time for one of the cases
 		time.Sleep(2 * time.Nanosecond)
 
-		userID, err := ValidateJWT(tokString, tokenSecret)
-		if err != c.expectedError || userID != c.expectedID {
+		principal, err := ValidateJWT(context.Background(), tokString, keyring, nil)
+		if err != c.expectedError || principal.UserID != c.expectedID {
 			t.Errorf("Failed to validate token: %v", err)
 			t.Fail()
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestChallengeJWTIsNotAnAccessToken(t *testing.T) {
+	userID := uuid.New()
+	keyring := testKeyring(t, "current")
+	challenge, err := MakeChallengeJWT(userID, keyring, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make challenge token: %v", err)
+	}
+	access, err := MakeJWT(Principal{UserID: userID}, keyring, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make access token: %v", err)
+	}
+
+	validateAccess := func(tokenString string, keyring *Keyring) error {
+		_, err := ValidateJWT(context.Background(), tokenString, keyring, nil)
+		return err
+	}
+	validateChallenge := func(tokenString string, keyring *Keyring) error {
+		_, err := ValidateChallengeJWT(tokenString, keyring)
+		return err
+	}
+
+	cases := []struct{
+		name string
+		validate func(tokenString string, keyring *Keyring) error
+		token string
+		expectedError error
+	}{
+		{name: "challenge as challenge", validate: validateChallenge, token: challenge, expectedError: nil},
+		{name: "challenge as access", validate: validateAccess, token: challenge, expectedError: ErrInvalidOrExpiredToken},
+		{name: "access as challenge", validate: validateChallenge, token: access, expectedError: ErrInvalidOrExpiredToken},
+	}
+
+	for _, c := range cases {
+		if err := c.validate(c.token, keyring); err != c.expectedError {
+			t.Errorf("Test failed for %s, expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+}
+
+func TestJWTRolesAndScopes(t *testing.T) {
+	keyring := testKeyring(t, "current")
+	userID := uuid.New()
+	legacy, err := makeJWT(accessTokenIssuer, Principal{UserID: userID}, keyring, time.Minute)
+	if err != nil {
+		t.Fatalf("could not make token: %v", err)
+	}
+
+	cases := []struct{
+		name string
+		principal Principal
+		expectedRoles []string
+		expectedScopes []string
+	}{
+		{
+			name: "admin",
+			principal: Principal{UserID: userID, Roles: []string{RoleUser, RoleModerator, RoleAdmin}, Scopes: DefaultScopes},
+			expectedRoles: []string{RoleUser, RoleModerator, RoleAdmin},
+			expectedScopes: DefaultScopes,
+		},
+		{
+			name: "narrow scope",
+			principal: Principal{UserID: userID, Roles: []string{RoleUser}, Scopes: []string{ScopeUsersRead}},
+			expectedRoles: []string{RoleUser},
+			expectedScopes: []string{ScopeUsersRead},
+		},
+		{
+			name: "session",
+			principal: Principal{UserID: userID, SessionID: uuid.New(), Roles: []string{RoleUser}, Scopes: DefaultScopes},
+			expectedRoles: []string{RoleUser},
+			expectedScopes: DefaultScopes,
+		},
+		{
+			name: "token from before roles",
+			expectedRoles: []string{RoleUser},
+			expectedScopes: DefaultScopes,
+		},
+	}
+
+	for _, c := range cases {
+		token := legacy
+		if c.principal.UserID != uuid.Nil {
+			token, err = MakeJWT(c.principal, keyring, time.Minute)
+			if err != nil {
+				t.Fatalf("could not make token: %v", err)
+			}
+		}
+		principal, err := ValidateJWT(context.Background(), token, keyring, nil)
+		if err != nil || principal.SessionID != c.principal.SessionID || !slices.Equal(principal.Roles, c.expectedRoles) || !slices.Equal(principal.Scopes, c.expectedScopes) {
+			t.Errorf("Test failed for %s, got %+v (%v)", c.name, principal, err)
+		}
+	}
+}
+
+func TestImpliedRoles(t *testing.T) {
+	cases := []struct{
+		role string
+		expected []string
+		expectedError error
+	}{
+		{role: RoleUser, expected: []string{RoleUser}},
+		{role: RoleModerator, expected: []string{RoleUser, RoleModerator}},
+		{role: RoleAdmin, expected: []string{RoleUser, RoleModerator, RoleAdmin}},
+		{role: "root", expectedError: ErrUnknownRole},
+	}
+
+	for _, c := range cases {
+		roles, err := ImpliedRoles(c.role)
+		if err != c.expectedError || !slices.Equal(roles, c.expected) {
+			t.Errorf("Test failed for %s, expected %v but got %v (%v)", c.role, c.expected, roles, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnsupportedKey = errors.New("only Ed25519 and RSA keys are supported")
+var ErrNoSigningKey = errors.New("keyring has no private key to sign with")
+var ErrUnknownKeyID = errors.New("no key with that id")
+
+// Key is one entry of a Keyring. Keys loaded from a public key can verify
+// tokens but not sign them, which is how a retired key is kept around until
+// the tokens it signed have expired.
+type Key struct {
+	ID string
+	private crypto.Signer
+	public crypto.PublicKey
+	method jwt.SigningMethod
+}
+
+// NewKey wraps an Ed25519 or RSA private key.
+func NewKey(id string, private crypto.Signer) (Key, error) {
+	key, err := NewPublicKey(id, private.Public())
+	if err != nil {
+		return Key{}, err
+	}
+	key.private = private
+	return key, nil
+}
+
+// NewPublicKey wraps an Ed25519 or RSA public key for verification only.
+func NewPublicKey(id string, public crypto.PublicKey) (Key, error) {
+	key := Key{ID: id, public: public}
+	switch public.(type) {
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+	return key, nil
+}
+
+// GenerateKey makes a new Ed25519 key.
+func GenerateKey(id string) (Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	return NewKey(id, private)
+}
+
+// ParseKeyPEM reads a PKCS #8 private key or a PKIX public key, as written by
+// "openssl genpkey" and "openssl pkey -pubout".
+func ParseKeyPEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s is not PEM encoded", id)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", id, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return Key{}, ErrUnsupportedKey
+		}
+		return NewKey(id, signer)
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", id, err)
+		}
+		return NewPublicKey(id, public)
+	}
+	return Key{}, fmt.Errorf("key %s has unexpected PEM type %q", id, block.Type)
+}
+
+func (k Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+func (k Key) CanSign() bool {
+	return k.private != nil
+}
+
+// LoadKeys reads every *.pem file in dir. The file name without the
+// extension becomes the key id.
+func LoadKeys(dir string) ([]Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKeyPEM(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Keyring signs tokens with one key and verifies them with any of its keys,
+// picked by the kid header.
+type Keyring struct {
+	signing Key
+	keys map[string]Key
+	legacySecret []byte
+}
+
+// NewKeyring signs with the key named signingKeyID, or with the last private
+// key by id when it is empty, so date-named keys rotate by adding a file.
+// A non-empty legacySecret keeps HS256 tokens without a kid valid.
+func NewKeyring(signingKeyID string, keys []Key, legacySecret string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := keyring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		keyring.keys[key.ID] = key
+		if key.CanSign() && (signingKeyID == key.ID || signingKeyID == "" && key.ID > keyring.signing.ID) {
+			keyring.signing = key
+		}
+	}
+	if !keyring.signing.CanSign() {
+		return nil, ErrNoSigningKey
+	}
+	if legacySecret != "" {
+		keyring.legacySecret = []byte(legacySecret)
+	}
+	return keyring, nil
+}
+
+func (k *Keyring) SigningKeyID() string {
+	return k.signing.ID
+}
+
+// verificationKey is the jwt.Keyfunc for tokens signed by this keyring.
+func (k *Keyring) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if k.legacySecret != nil && token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			return k.legacySecret, nil
+		}
+		return nil, ErrUnknownKeyID
+	}
+	key, ok := k.keys[kid]
+	if !ok || token.Method.Alg() != key.Algorithm() {
+		return nil, ErrUnknownKeyID
+	}
+	return key.public, nil
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	KeyType string `json:"kty"`
+	KeyID string `json:"kid"`
+	Use string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve string `json:"crv,omitempty"`
+	X string `json:"x,omitempty"`
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public half of every key, retired ones included, so
+// tokens they signed can still be verified. The legacy secret is never
+// published.
+func (k *Keyring) JWKS() JWKS {
+	ids := k.KeyIDs()
+	set := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := JWK{KeyID: id, Use: "sig", Algorithm: key.Algorithm()}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// KeyIDs returns the id of every key, sorted.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	oldKey, err := GenerateKey("2026-01-01")
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %v", err)
+	}
+	newKey, err := NewKey("2026-06-01", rsaPrivate)
+	if err != nil {
+		t.Fatalf("could not wrap rsa key: %v", err)
+	}
+	retiredKey, err := NewPublicKey(oldKey.ID, oldKey.public)
+	if err != nil {
+		t.Fatalf("could not wrap public key: %v", err)
+	}
+
+	before, err := NewKeyring("", []Key{oldKey}, "")
+	if err != nil {
+		t.Fatalf("could not make keyring: %v", err)
+	}
+	oldToken, err := MakeJWT(Principal{UserID: userID}, before, time.Hour)
+	if err != nil {
+		t.Fatalf("could not make token: %v", err)
+	}
+	// The newest key signs and the old one is kept for verification only.
+	after, err := NewKeyring("", []Key{retiredKey, newKey}, "")
+	if err != nil {
+		t.Fatalf("could not make keyring: %v", err)
+	}
+	if after.SigningKeyID() != newKey.ID {
+		t.Fatalf("expected %s to sign, got %s", newKey.ID, after.SigningKeyID())
+	}
+	newToken, err := MakeJWT(Principal{UserID: userID}, after, time.Hour)
+	if err != nil {
+		t.Fatalf("could not make token: %v", err)
+	}
+
+	cases := []struct{
+		name string
+		token string
+		keyring *Keyring
+		expectedError error
+	}{
+		{name: "old token before rotation", token: oldToken, keyring: before, expectedError: nil},
+		{name: "old token after rotation", token: oldToken, keyring: after, expectedError: nil},
+		{name: "new token after rotation", token: newToken, keyring: after, expectedError: nil},
+		{name: "new token on a keyring without its key", token: newToken, keyring: before, expectedError: ErrInvalidOrExpiredToken},
+	}
+
+	for _, c := range cases {
+		principal, err := ValidateJWT(context.Background(), c.token, c.keyring, nil)
+		if err != c.expectedError || (err == nil && principal.UserID != userID) {
+			t.Errorf("Test failed for %s, expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+
+	if _, err := NewKeyring("", []Key{retiredKey}, ""); err != ErrNoSigningKey {
+		t.Errorf("expected a keyring of public keys to have no signing key, got %v", err)
+	}
+}
+
+func TestLegacySecret(t *testing.T) {
+	userID := uuid.New()
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer: accessTokenIssuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject: userID.String(),
+	})
+	legacyToken, err := legacy.SignedString([]byte("legacy-secret"))
+	if err != nil {
+		t.Fatalf("could not sign legacy token: %v", err)
+	}
+	key, err := GenerateKey("current")
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	cases := []struct{
+		name string
+		legacySecret string
+		expectedError error
+	}{
+		{name: "legacy secret configured", legacySecret: "legacy-secret", expectedError: nil},
+		{name: "wrong legacy secret", legacySecret: "other-secret", expectedError: ErrInvalidOrExpiredToken},
+		{name: "no legacy secret", legacySecret: "", expectedError: ErrInvalidOrExpiredToken},
+	}
+
+	for _, c := range cases {
+		keyring, err := NewKeyring("", []Key{key}, c.legacySecret)
+		if err != nil {
+			t.Fatalf("could not make keyring: %v", err)
+		}
+		if _, err := ValidateJWT(context.Background(), legacyToken, keyring, nil); err != c.expectedError {
+			t.Errorf("Test failed for %s, expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+}
+
+func TestLoadKeysAndJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %v", err)
+	}
+	edKey, err := GenerateKey("unused")
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(rsaPrivate)
+	if err != nil {
+		t.Fatalf("could not marshal private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(edKey.public)
+	if err != nil {
+		t.Fatalf("could not marshal public key: %v", err)
+	}
+	files := map[string]*pem.Block{
+		"a-retired.pem": {Type: "PUBLIC KEY", Bytes: publicDER},
+		"b-current.pem": {Type: "PRIVATE KEY", Bytes: privateDER},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("could not write key: %v", err)
+		}
+	}
+
+	keys, err := LoadKeys(dir)
+	if err != nil {
+		t.Fatalf("could not load keys: %v", err)
+	}
+	keyring, err := NewKeyring("", keys, "")
+	if err != nil {
+		t.Fatalf("could not make keyring: %v", err)
+	}
+	if keyring.SigningKeyID() != "b-current" {
+		t.Errorf("expected b-current to sign, got %s", keyring.SigningKeyID())
+	}
+
+	jwks := keyring.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys in the JWKS, got %d", len(jwks.Keys))
+	}
+	cases := []struct{
+		jwk JWK
+		expectedID string
+		expectedType string
+		expectedAlgorithm string
+	}{
+		{jwk: jwks.Keys[0], expectedID: "a-retired", expectedType: "OKP", expectedAlgorithm: "EdDSA"},
+		{jwk: jwks.Keys[1], expectedID: "b-current", expectedType: "RSA", expectedAlgorithm: "RS256"},
+	}
+
+	for _, c := range cases {
+		if c.jwk.KeyID != c.expectedID || c.jwk.KeyType != c.expectedType || c.jwk.Algorithm != c.expectedAlgorithm || c.jwk.Use != "sig" {
+			t.Errorf("Test failed for %s, got %+v", c.expectedID, c.jwk)
+		}
+	}
+	if jwks.Keys[1].E != "AQAB" || jwks.Keys[1].N == "" || jwks.Keys[0].X == "" {
+		t.Errorf("expected public key material in the JWKS, got %+v", jwks.Keys)
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUnknownRole = errors.New("role must be user, moderator or admin")
+
+const (
+	RoleUser = "user"
+	RoleModerator = "moderator"
+	RoleAdmin = "admin"
+)
+
+const (
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUsersRead = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// roleOrder lists roles from least to most privileged. Each role includes
+// every role before it.
+var roleOrder = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// DefaultScopes are what an access token from logging in is good for.
+var DefaultScopes = []string{ScopeChirpsWrite, ScopeUsersRead, ScopeUsersWrite}
+
+// ImpliedRoles expands role into itself and every role below it, so checks
+// only ever need to ask for the lowest role that is enough.
+func ImpliedRoles(role string) ([]string, error) {
+	i := slices.Index(roleOrder, role)
+	if i < 0 {
+		return nil, ErrUnknownRole
+	}
+	return slices.Clone(roleOrder[:i+1]), nil
+}
+
+// Principal is who a request is made by and what it may do.
+type Principal struct {
+	// UserID is uuid.Nil for principals that are not a user, like the
+	// admin API key.
+	UserID uuid.UUID
+	// SessionID is the refresh token family an access token was issued
+	// for, or uuid.Nil for credentials that are not part of a session.
+	SessionID uuid.UUID
+	// APIKeyID is the personal API key the principal authenticated with, or
+	// uuid.Nil for other credentials.
+	APIKeyID uuid.UUID
+	Roles []string
+	Scopes []string
+	// TokenID and ExpiresAt identify the access token the principal came
+	// from, so it can be revoked. Other credentials leave them empty.
+	TokenID string
+	ExpiresAt time.Time
+}
+
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 )
@@ -15,4 +16,12 @@ func MakeRefreshToken() (string, error) {
 		return "", ErrCouldNotMakeRefreshToken
 	}
 	return hex.EncodeToString(randNum), nil
-}
\ No newline at end of file
+}
+
+// HashToken returns the hex encoded SHA-256 digest of an opaque token. Only
+// the digest is stored, so reading the database is not enough to use a token.
+// Tokens are random, which is why a fast unsalted hash is enough here.
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestHashToken(t *testing.T) {
+	cases := []struct{
+		input string
+		expected string
+	}{
+		{
+			input: "",
+			expected: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			input: "abc",
+			expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+	}
+
+	for _, c := range cases {
+		actual := HashToken(c.input)
+		if actual != c.expected {
+			t.Errorf("Test failed for token %q: expected %s, got %s", c.input, c.expected, actual)
+		}
+	}
+
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("could not make refresh token: %v", err)
+	}
+	if HashToken(token) == token {
+		t.Errorf("expected digest to differ from the token")
+	}
+}
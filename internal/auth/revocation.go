@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+var ErrCheckingRevocations = errors.New("could not check whether token was revoked")
+
+// Revocations looks up access tokens that were revoked before they expired.
+type Revocations interface {
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// TokensValidAfter is when every token of a user was last revoked, or
+	// the zero time if that never happened.
+	TokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+type cachedEntry[T any] struct {
+	value T
+	until time.Time
+}
+
+// RevocationCache remembers what its store answered for ttl, so checking
+// every request does not cost a lookup each. Revocations made through the
+// cache apply at once; ones made elsewhere take up to ttl to be seen.
+// It is safe for concurrent use.
+type RevocationCache struct {
+	store Revocations
+	ttl time.Duration
+
+	mu sync.Mutex
+	tokens map[string]cachedEntry[bool]
+	users map[uuid.UUID]cachedEntry[time.Time]
+}
+
+func NewRevocationCache(store Revocations, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{
+		store: store,
+		ttl: ttl,
+		tokens: map[string]cachedEntry[bool]{},
+		users: map[uuid.UUID]cachedEntry[time.Time]{},
+	}
+}
+
+func (c *RevocationCache) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	c.mu.Lock()
+	entry, ok := c.tokens[tokenID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.until) {
+		return entry.value, nil
+	}
+	revoked, err := c.store.IsTokenRevoked(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	c.tokens[tokenID] = cachedEntry[bool]{value: revoked, until: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return revoked, nil
+}
+
+func (c *RevocationCache) TokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	c.mu.Lock()
+	entry, ok := c.users[userID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.until) {
+		return entry.value, nil
+	}
+	validAfter, err := c.store.TokensValidAfter(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.mu.Lock()
+	c.users[userID] = cachedEntry[time.Time]{value: validAfter, until: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return validAfter, nil
+}
+
+// RevokeToken records a revocation already saved to the store. A revoked
+// token stays revoked, so it is remembered until the token expires.
+func (c *RevocationCache) RevokeToken(tokenID string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[tokenID] = cachedEntry[bool]{value: true, until: expiresAt}
+}
+
+// RevokeUserTokens records a TokensValidAfter already saved to the store.
+func (c *RevocationCache) RevokeUserTokens(userID uuid.UUID, validAfter time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[userID] = cachedEntry[time.Time]{value: validAfter, until: time.Now().Add(c.ttl)}
+}
+
+// Purge forgets entries that have run out, and returns how many there were.
+func (c *RevocationCache) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	purged := 0
+	for tokenID, entry := range c.tokens {
+		if !now.Before(entry.until) {
+			delete(c.tokens, tokenID)
+			purged++
+		}
+	}
+	for userID, entry := range c.users {
+		if !now.Before(entry.until) {
+			delete(c.users, userID)
+			purged++
+		}
+	}
+	return purged
+}
+
+// checkRevoked rejects a token whose jti was revoked or that was issued
+// before its user's tokens were all revoked. iat only has second precision,
+// so validAfter is truncated to the second before comparing: a token issued
+// in the same second as a revocation of all tokens survives it. Revoking a
+// single token by its jti has no such gap.
+func checkRevoked(ctx context.Context, revocations Revocations, principal Principal, issuedAt time.Time) error {
+	validAfter, err := revocations.TokensValidAfter(ctx, principal.UserID)
+	if err != nil {
+		return errors.Join(ErrCheckingRevocations, err)
+	}
+	if issuedAt.Before(validAfter.Truncate(time.Second)) {
+		return ErrTokenRevoked
+	}
+	if principal.TokenID == "" {
+		return nil
+	}
+	revoked, err := revocations.IsTokenRevoked(ctx, principal.TokenID)
+	if err != nil {
+		return errors.Join(ErrCheckingRevocations, err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
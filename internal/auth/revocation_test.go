@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeRevocations counts lookups so tests can tell cache hits from misses.
+type fakeRevocations struct {
+	revoked map[string]bool
+	validAfter map[uuid.UUID]time.Time
+	lookups int
+}
+
+func (f *fakeRevocations) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	f.lookups++
+	return f.revoked[tokenID], nil
+}
+
+func (f *fakeRevocations) TokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	f.lookups++
+	return f.validAfter[userID], nil
+}
+
+func TestRevokedJWT(t *testing.T) {
+	keyring := testKeyring(t, "current")
+	userID := uuid.New()
+	makeToken := func() (string, Principal) {
+		t.Helper()
+		token, err := MakeJWT(Principal{UserID: userID, Roles: []string{RoleUser}, Scopes: DefaultScopes}, keyring, time.Hour)
+		if err != nil {
+			t.Fatalf("could not make token: %v", err)
+		}
+		principal, err := ValidateJWT(context.Background(), token, keyring, nil)
+		if err != nil || principal.TokenID == "" {
+			t.Fatalf("expected a token with a jti, got %+v (%v)", principal, err)
+		}
+		return token, principal
+	}
+	revokedToken, revokedPrincipal := makeToken()
+	validToken, _ := makeToken()
+
+	cases := []struct{
+		name string
+		token string
+		store *fakeRevocations
+		expectedError error
+	}{
+		{
+			name: "nothing revoked",
+			token: validToken,
+			store: &fakeRevocations{},
+			expectedError: nil,
+		},
+		{
+			name: "jti revoked",
+			token: revokedToken,
+			store: &fakeRevocations{revoked: map[string]bool{revokedPrincipal.TokenID: true}},
+			expectedError: ErrTokenRevoked,
+		},
+		{
+			name: "issued before all tokens were revoked",
+			token: validToken,
+			store: &fakeRevocations{validAfter: map[uuid.UUID]time.Time{userID: time.Now().Add(time.Minute)}},
+			expectedError: ErrTokenRevoked,
+		},
+		{
+			name: "issued after all tokens were revoked",
+			token: validToken,
+			store: &fakeRevocations{validAfter: map[uuid.UUID]time.Time{userID: time.Now().Add(-time.Minute)}},
+			expectedError: nil,
+		},
+	}
+
+	for _, c := range cases {
+		if _, err := ValidateJWT(context.Background(), c.token, keyring, c.store); err != c.expectedError {
+			t.Errorf("Test failed for %s, expected %v but got %v", c.name, c.expectedError, err)
+		}
+	}
+}
+
+func TestRevocationCache(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	store := &fakeRevocations{revoked: map[string]bool{}, validAfter: map[uuid.UUID]time.Time{}}
+	cache := NewRevocationCache(store, time.Hour)
+
+	for range 3 {
+		if revoked, err := cache.IsTokenRevoked(ctx, "a"); err != nil || revoked {
+			t.Fatalf("expected token a not to be revoked, got %v (%v)", revoked, err)
+		}
+		if _, err := cache.TokensValidAfter(ctx, userID); err != nil {
+			t.Fatalf("could not look up user: %v", err)
+		}
+	}
+	if store.lookups != 2 {
+		t.Errorf("expected lookups to be cached, got %d lookups", store.lookups)
+	}
+
+	// Revoking through the cache overrides what it remembered.
+	validAfter := time.Now()
+	cache.RevokeToken("a", time.Now().Add(time.Hour))
+	cache.RevokeUserTokens(userID, validAfter)
+	if revoked, _ := cache.IsTokenRevoked(ctx, "a"); !revoked {
+		t.Errorf("expected token a to be revoked right away")
+	}
+	if got, _ := cache.TokensValidAfter(ctx, userID); !got.Equal(validAfter) {
+		t.Errorf("expected tokens to be valid after %v, got %v", validAfter, got)
+	}
+
+	cache.RevokeToken("expired", time.Now().Add(-time.Second))
+	if purged := cache.Purge(); purged != 1 {
+		t.Errorf("expected 1 expired entry to be purged, got %d", purged)
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTOTPSecret = errors.New("invalid totp secret")
+var ErrCouldNotMakeTOTPSecret = errors.New("could not make totp secret")
+
+// TOTP parameters from RFC 6238 that authenticator apps assume by default.
+const (
+	TOTPPeriod = 30 * time.Second
+	TOTPDigits = 6
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MakeTOTPSecret returns a random 160 bit secret, base32 encoded as
+// authenticator apps expect.
+func MakeTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", ErrCouldNotMakeTOTPSecret
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI builds the otpauth:// URI that authenticator apps read from a QR code.
+func TOTPURI(issuer, accountName, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(TOTPDigits))
+	values.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// TOTPStep is the number of periods since the Unix epoch at t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode computes the HOTP value (RFC 4226) of secret for step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", ErrInvalidTOTPSecret
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulus), nil
+}
+
+// ValidateTOTP checks code against the step at now and one step either side,
+// to allow for clock drift. It returns the step that matched so callers can
+// refuse to accept the same code twice.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := TOTPStep(now)
+	for _, step := range []int64{current, current - 1, current + 1} {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// MakeRecoveryCodes returns n single-use codes like "k3j9x-7qa2m". They are
+// too short for HashToken, so store them with HashPassword.
+func MakeRecoveryCodes(n int) ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, n)
+	random := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(random); err != nil {
+			return nil, ErrCouldNotMakeTOTPSecret
+		}
+		var code strings.Builder
+		for j, b := range random {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			// 256 is not a multiple of the alphabet size, so some letters are
+			// slightly more likely; 10 characters still leave ~49 bits.
+			code.WriteByte(alphabet[int(b)%len(alphabet)])
+		}
+		codes[i] = code.String()
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode undoes formatting users tend to add when typing a
+// recovery code back in.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// The SHA-1 test vectors from RFC 6238, truncated to six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := []struct{
+		unix int64
+		expectedCode string
+	}{
+		{unix: 59, expectedCode: "287082"},
+		{unix: 1111111109, expectedCode: "081804"},
+		{unix: 1111111111, expectedCode: "050471"},
+		{unix: 1234567890, expectedCode: "005924"},
+		{unix: 2000000000, expectedCode: "279037"},
+		{unix: 20000000000, expectedCode: "353130"},
+	}
+
+	for _, c := range cases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil || code != c.expectedCode {
+			t.Errorf("Test failed at %d, expected %s but got %s (%v)", c.unix, c.expectedCode, code, err)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := MakeTOTPSecret()
+	if err != nil {
+		t.Fatalf("could not make secret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := TOTPCode(secret, TOTPStep(now))
+
+	cases := []struct{
+		name string
+		at time.Time
+		code string
+		expectedValid bool
+	}{
+		{name: "same period", at: now, code: code, expectedValid: true},
+		{name: "next period", at: now.Add(TOTPPeriod), code: code, expectedValid: true},
+		{name: "two periods later", at: now.Add(2 * TOTPPeriod), code: code, expectedValid: false},
+		{name: "wrong code", at: now, code: "000000", expectedValid: code == "000000"},
+		{name: "empty code", at: now, code: "", expectedValid: false},
+	}
+
+	for _, c := range cases {
+		step, valid := ValidateTOTP(secret, c.code, c.at)
+		if valid != c.expectedValid {
+			t.Errorf("Test failed for %s, expected valid=%v", c.name, c.expectedValid)
+		}
+		if valid && step != TOTPStep(now) {
+			t.Errorf("Test failed for %s, expected the matching step to be returned", c.name)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "walt@example.com", "JBSWY3DPEHPK3PXP")
+	expected := "otpauth://totp/Chirpy:walt@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=JBSWY3DPEHPK3PXP"
+	if uri != expected {
+		t.Errorf("expected %s, got %s", expected, uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := MakeRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("could not make recovery codes: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("unexpected recovery code %q", code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if NormalizeRecoveryCode(typed) != code {
+			t.Errorf("expected %q to normalize to %q, got %q", typed, code, NormalizeRecoveryCode(typed))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	const secret = "polka-secret"
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Now()
+
+	signed := func(timestamp time.Time) http.Header {
+		headers := http.Header{}
+		SetWebhookSignature(headers, secret, timestamp, body)
+		return headers
+	}
+	tampered := signed(now)
+	tampered.Set(WebhookTimestampHeader, strconv.FormatInt(now.Add(time.Second).Unix(), 10))
+
+	cases := []struct{
+		name string
+		headers http.Header
+		secret string
+		expectedError error
+	}{
+		{
+			name: "valid",
+			headers: signed(now),
+			secret: secret,
+			expectedError: nil,
+		},
+		{
+			name: "within skew",
+			headers: signed(now.Add(-4 * time.Minute)),
+			secret: secret,
+			expectedError: nil,
+		},
+		{
+			name: "too old",
+			headers: signed(now.Add(-10 * time.Minute)),
+			secret: secret,
+			expectedError: ErrWebhookTimestampOutOfRange,
+		},
+		{
+			name: "too far in the future",
+			headers: signed(now.Add(10 * time.Minute)),
+			secret: secret,
+			expectedError: ErrWebhookTimestampOutOfRange,
+		},
+		{
+			name: "wrong secret",
+			headers: signed(now),
+			secret: "other-secret",
+			expectedError: ErrInvalidWebhookSignature,
+		},
+		{
+			name: "timestamp changed after signing",
+			headers: tampered,
+			secret: secret,
+			expectedError: ErrInvalidWebhookSignature,
+		},
+		{
+			name: "missing headers",
+			headers: http.Header{},
+			secret: secret,
+			expectedError: ErrMissingWebhookSignature,
+		},
+	}
+
+	for _, c := range cases {
+		err := VerifyWebhookSignature(c.headers, c.secret, body, now, 5*time.Minute)
+		if err != c.expectedError {
+			t.Errorf("Test failed for %s: expected %v, got %v", c.name, c.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+// Package config loads the server settings from defaults, an optional JSON
+// file, the environment and command line flags, in increasing precedence.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/ratelimit"
+)
+
+// MinSecretLength is the shortest JWT signing secret accepted, in bytes.
+const MinSecretLength = 32
+
+const (
+	PlatformDev = "dev"
+	PlatformProd = "prod"
+)
+
+// There is no mailer that delivers email yet. The file mailer is the only
+// one allowed outside dev, and it writes each email to MAIL_DIR for something
+// else to send.
+const (
+	MailerLog = "log"
+	MailerFile = "file"
+)
+
+// defaultMailer is the mailer used when MAILER is not set.
+func defaultMailer(platform string) string {
+	if platform == PlatformDev {
+		return MailerLog
+	}
+	return MailerFile
+}
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Secret is a string that redacts itself when printed, logged or marshalled.
+// Use Value to get at the real contents.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+type Config struct {
+	Platform string
+	Port int
+	FilepathRoot string
+	LogFormat string
+	LogLevel string
+
+	DBURL Secret
+	DBMaxOpenConns int
+	DBMaxIdleConns int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	MigrateOnStart bool
+
+	Secret Secret
+	JWTKeysDir string
+	JWTSigningKeyID string
+	RevocationCacheTTL time.Duration
+	RevocationSweepInterval time.Duration
+	PolkaKey Secret
+	PolkaWebhookSecret Secret
+	PolkaWebhookMaxSkew time.Duration
+	WebhookEventSweepInterval time.Duration
+	SubscriptionSweepInterval time.Duration
+
+	HTTPReadTimeout time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout time.Duration
+	ShutdownTimeout time.Duration
+	ShutdownDrainDelay time.Duration
+	ReadinessTimeout time.Duration
+
+	RateLimits string
+	RateLimitRedMultiplier int
+	TrustForwardedFor bool
+
+	LoginMaxFailures int
+	LoginMaxFailuresPerIP int
+	LoginLockoutBase time.Duration
+	LoginLockoutMax time.Duration
+	LoginFailureWindow time.Duration
+	AdminAPIKey Secret
+
+	PublicURL string
+	Mailer string
+	MailDir string
+	MailFrom string
+	PasswordResetTTL time.Duration
+	EmailVerificationTTL time.Duration
+	RequireVerifiedEmail bool
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		Platform: PlatformProd,
+		Port: 8080,
+		FilepathRoot: ".",
+		LogFormat: "text",
+		LogLevel: "info",
+		DBMaxOpenConns: 25,
+		DBMaxIdleConns: 25,
+		DBConnMaxLifetime: 30 * time.Minute,
+		DBConnMaxIdleTime: 5 * time.Minute,
+		RevocationCacheTTL: 30 * time.Second,
+		RevocationSweepInterval: time.Hour,
+		PolkaWebhookMaxSkew: 5 * time.Minute,
+		WebhookEventSweepInterval: time.Hour,
+		SubscriptionSweepInterval: time.Minute,
+		HTTPReadTimeout: 10 * time.Second,
+		HTTPWriteTimeout: 30 * time.Second,
+		HTTPIdleTimeout: 2 * time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+		ReadinessTimeout: 2 * time.Second,
+		RateLimits: "POST /api/login=10/1m,POST /api/users=10/1m,POST /api/refresh=30/1m,POST /api/chirps=30/1m,POST /api/password/forgot=5/1m,POST /api/password/reset=10/1m,POST /api/users/verify=10/1m,POST /api/login/2fa=10/1m",
+		RateLimitRedMultiplier: 1,
+		LoginMaxFailures: 5,
+		LoginMaxFailuresPerIP: 20,
+		LoginLockoutBase: time.Minute,
+		LoginLockoutMax: time.Hour,
+		LoginFailureWindow: 24 * time.Hour,
+		PublicURL: "http://localhost:8080",
+		Mailer: defaultMailer(PlatformProd),
+		MailDir: "mail",
+		MailFrom: "Chirpy <no-reply@chirpy.local>",
+		PasswordResetTTL: 30 * time.Minute,
+		EmailVerificationTTL: 24 * time.Hour,
+	}
+}
+
+// setting describes one option. name is the environment variable; the file
+// key is name in lower case and the flag is that with dashes.
+type setting struct {
+	name string
+	usage string
+	value func(c *Config) any
+}
+
+func (s setting) fileKey() string {
+	return strings.ToLower(s.name)
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.fileKey(), "_", "-")
+}
+
+var settings = []setting{
+	{name: "PLATFORM", usage: "dev enables the in-memory store", value: func(c *Config) any { return &c.Platform }},
+	{name: "PORT", usage: "port to listen on", value: func(c *Config) any { return &c.Port }},
+	{name: "FILEPATH_ROOT", usage: "directory served under /app/", value: func(c *Config) any { return &c.FilepathRoot }},
+	{name: "LOG_FORMAT", usage: "text or json", value: func(c *Config) any { return &c.LogFormat }},
+	{name: "LOG_LEVEL", usage: "debug, info, warn or error", value: func(c *Config) any { return &c.LogLevel }},
+	{name: "DB_URL", usage: "postgres connection URL", value: func(c *Config) any { return &c.DBURL }},
+	{name: "DB_MAX_OPEN_CONNS", usage: "maximum open database connections", value: func(c *Config) any { return &c.DBMaxOpenConns }},
+	{name: "DB_MAX_IDLE_CONNS", usage: "maximum idle database connections", value: func(c *Config) any { return &c.DBMaxIdleConns }},
+	{name: "DB_CONN_MAX_LIFETIME", usage: "how long a database connection is reused", value: func(c *Config) any { return &c.DBConnMaxLifetime }},
+	{name: "DB_CONN_MAX_IDLE_TIME", usage: "how long a database connection may sit idle", value: func(c *Config) any { return &c.DBConnMaxIdleTime }},
+	{name: "MIGRATE_ON_START", usage: "apply pending migrations at startup", value: func(c *Config) any { return &c.MigrateOnStart }},
+	{name: "SECRET", usage: "legacy HS256 secret; tokens it signed are still accepted", value: func(c *Config) any { return &c.Secret }},
+	{name: "JWT_KEYS_DIR", usage: "directory of <kid>.pem Ed25519 or RSA keys; public keys only verify", value: func(c *Config) any { return &c.JWTKeysDir }},
+	{name: "JWT_SIGNING_KEY_ID", usage: "kid of the key that signs new tokens, by default the last private key by name", value: func(c *Config) any { return &c.JWTSigningKeyID }},
+	{name: "REVOCATION_CACHE_TTL", usage: "how long a revocation made by another instance may take to be seen", value: func(c *Config) any { return &c.RevocationCacheTTL }},
+	{name: "REVOCATION_SWEEP_INTERVAL", usage: "how often expired revoked access tokens are purged", value: func(c *Config) any { return &c.RevocationSweepInterval }},
+	{name: "POLKA_KEY", usage: "API key Polka sends with webhooks", value: func(c *Config) any { return &c.PolkaKey }},
+	{name: "POLKA_WEBHOOK_SECRET", usage: "HMAC secret for signed Polka webhooks", value: func(c *Config) any { return &c.PolkaWebhookSecret }},
+	{name: "POLKA_WEBHOOK_MAX_SKEW", usage: "allowed age of a signed webhook", value: func(c *Config) any { return &c.PolkaWebhookMaxSkew }},
+	{name: "WEBHOOK_EVENT_SWEEP_INTERVAL", usage: "how often ids of signed webhooks older than twice POLKA_WEBHOOK_MAX_SKEW are purged", value: func(c *Config) any { return &c.WebhookEventSweepInterval }},
+	{name: "SUBSCRIPTION_SWEEP_INTERVAL", usage: "how often lapsed subscriptions are expired", value: func(c *Config) any { return &c.SubscriptionSweepInterval }},
+	{name: "HTTP_READ_TIMEOUT", usage: "time allowed to read a request", value: func(c *Config) any { return &c.HTTPReadTimeout }},
+	{name: "HTTP_WRITE_TIMEOUT", usage: "time allowed to write a response", value: func(c *Config) any { return &c.HTTPWriteTimeout }},
+	{name: "HTTP_IDLE_TIMEOUT", usage: "how long keep-alive connections stay open", value: func(c *Config) any { return &c.HTTPIdleTimeout }},
+	{name: "SHUTDOWN_TIMEOUT", usage: "time allowed to drain requests on shutdown", value: func(c *Config) any { return &c.ShutdownTimeout }},
+	{name: "SHUTDOWN_DRAIN_DELAY", usage: "time to keep serving after readiness starts failing", value: func(c *Config) any { return &c.ShutdownDrainDelay }},
+	{name: "READINESS_TIMEOUT", usage: "time allowed for each readiness check", value: func(c *Config) any { return &c.ReadinessTimeout }},
+	{name: "RATE_LIMITS", usage: "comma separated route=requests/period limits, e.g. POST /api/login=5/1m", value: func(c *Config) any { return &c.RateLimits }},
+	{name: "RATE_LIMIT_RED_MULTIPLIER", usage: "how many times higher the limits are for Chirpy Red users", value: func(c *Config) any { return &c.RateLimitRedMultiplier }},
+	{name: "TRUST_FORWARDED_FOR", usage: "use X-Forwarded-For for the client IP when behind a proxy", value: func(c *Config) any { return &c.TrustForwardedFor }},
+	{name: "LOGIN_MAX_FAILURES", usage: "failed logins before an account is locked", value: func(c *Config) any { return &c.LoginMaxFailures }},
+	{name: "LOGIN_MAX_FAILURES_PER_IP", usage: "failed logins before a client IP is locked", value: func(c *Config) any { return &c.LoginMaxFailuresPerIP }},
+	{name: "LOGIN_LOCKOUT_BASE", usage: "length of the first lockout, doubled for each one after", value: func(c *Config) any { return &c.LoginLockoutBase }},
+	{name: "LOGIN_LOCKOUT_MAX", usage: "longest a lockout can last", value: func(c *Config) any { return &c.LoginLockoutMax }},
+	{name: "LOGIN_FAILURE_WINDOW", usage: "quiet period after which failed logins are forgotten", value: func(c *Config) any { return &c.LoginFailureWindow }},
+	{name: "ADMIN_API_KEY", usage: "API key that is granted the admin role", value: func(c *Config) any { return &c.AdminAPIKey }},
+	{name: "PUBLIC_URL", usage: "base URL used in links sent to users", value: func(c *Config) any { return &c.PublicURL }},
+	{name: "MAILER", usage: "log to log emails, on the dev platform only, or file to write them to MAIL_DIR; defaults to log on dev and file elsewhere", value: func(c *Config) any { return &c.Mailer }},
+	{name: "MAIL_DIR", usage: "directory the file mailer writes to", value: func(c *Config) any { return &c.MailDir }},
+	{name: "MAIL_FROM", usage: "sender address for emails", value: func(c *Config) any { return &c.MailFrom }},
+	{name: "PASSWORD_RESET_TTL", usage: "how long a password reset link works", value: func(c *Config) any { return &c.PasswordResetTTL }},
+	{name: "EMAIL_VERIFICATION_TTL", usage: "how long an email verification link works", value: func(c *Config) any { return &c.EmailVerificationTTL }},
+	{name: "REQUIRE_VERIFIED_EMAIL", usage: "only let users with a verified email post chirps", value: func(c *Config) any { return &c.RequireVerifiedEmail }},
+}
+
+func set(target any, value string) error {
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *Secret:
+		*target = Secret(value)
+	case *int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*target = parsed
+	case *bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*target = parsed
+	case *time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		*target = parsed
+	default:
+		panic(fmt.Sprintf("config: unsupported setting type %T", target))
+	}
+	return nil
+}
+
+// Load builds the configuration from args (without the program name) and
+// getenv. The file named by -config or CONFIG_FILE is read first, then the
+// environment and finally flags override it. Arguments after the flags are
+// returned so callers can handle subcommands. The result is not validated.
+func Load(args []string, getenv func(string) string) (Config, []string, error) {
+	c := Default()
+	// The default mailer depends on the platform, so it is chosen once the
+	// platform is known.
+	c.Mailer = ""
+
+	flags := flag.NewFlagSet("atServer", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFile := flags.String("config", "", "path to a JSON config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.name] = flags.String(s.flagName(), "", s.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	path := *configFile
+	if path == "" {
+		path = getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.name); value != "" {
+			if err := set(s.value(&c), value); err != nil {
+				return Config{}, nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, s.name, err)
+			}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flagName() == f.Name && flagErr == nil {
+				if err := set(s.value(&c), *flagValues[s.name]); err != nil {
+					flagErr = fmt.Errorf("%w: -%s: %v", ErrInvalidConfig, f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, nil, flagErr
+	}
+	if c.Mailer == "" {
+		c.Mailer = defaultMailer(c.Platform)
+	}
+	return c, flags.Args(), nil
+}
+
+// loadFile applies a JSON object whose keys are the lower case setting names.
+// Values may be strings, numbers or booleans; durations are strings like "30s".
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	known := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		known[s.fileKey()] = s
+	}
+	for key, raw := range values {
+		s, ok := known[key]
+		if !ok {
+			return fmt.Errorf("%w: %s: unknown setting %q", ErrInvalidConfig, path, key)
+		}
+		value := string(raw)
+		var str string
+		if json.Unmarshal(raw, &str) == nil {
+			value = str
+		}
+		if err := set(s.value(c), value); err != nil {
+			return fmt.Errorf("%w: %s: %s: %v", ErrInvalidConfig, path, key, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every problem with the settings needed to serve requests.
+func (c Config) Validate() error {
+	var problems []error
+	addProblem := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Platform != PlatformDev && c.Platform != PlatformProd {
+		addProblem("PLATFORM must be %q or %q, got %q", PlatformDev, PlatformProd, c.Platform)
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		addProblem("PORT must be between 1 and 65535, got %d", c.Port)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		addProblem("LOG_FORMAT must be text or json, got %q", c.LogFormat)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		addProblem("LOG_LEVEL %q is not a log level", c.LogLevel)
+	}
+	if c.Secret != "" && len(c.Secret) < MinSecretLength {
+		addProblem("SECRET must be at least %d bytes, got %d", MinSecretLength, len(c.Secret))
+	}
+	// The dev platform signs with a key that only lasts until a restart.
+	if c.JWTKeysDir == "" && c.Platform != PlatformDev {
+		addProblem("JWT_KEYS_DIR is required")
+	}
+	// Only the dev platform may run without a database.
+	if c.DBURL != "" || c.Platform != PlatformDev {
+		if err := c.ValidateDBURL(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 {
+		addProblem("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS cannot be negative")
+	}
+
+	durations := map[string]time.Duration{
+		"DB_CONN_MAX_LIFETIME": c.DBConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME": c.DBConnMaxIdleTime,
+		"POLKA_WEBHOOK_MAX_SKEW": c.PolkaWebhookMaxSkew,
+		"HTTP_READ_TIMEOUT": c.HTTPReadTimeout,
+		"HTTP_WRITE_TIMEOUT": c.HTTPWriteTimeout,
+		"HTTP_IDLE_TIMEOUT": c.HTTPIdleTimeout,
+		"SHUTDOWN_TIMEOUT": c.ShutdownTimeout,
+		"SHUTDOWN_DRAIN_DELAY": c.ShutdownDrainDelay,
+	}
+	for _, s := range settings {
+		if d, ok := durations[s.name]; ok && d < 0 {
+			addProblem("%s cannot be negative", s.name)
+		}
+	}
+	if c.ReadinessTimeout <= 0 {
+		addProblem("READINESS_TIMEOUT must be positive")
+	}
+	if _, err := ratelimit.ParseRules(c.RateLimits); err != nil {
+		addProblem("RATE_LIMITS: %v", err)
+	}
+	if c.RateLimitRedMultiplier < 1 {
+		addProblem("RATE_LIMIT_RED_MULTIPLIER must be at least 1")
+	}
+	if c.LoginMaxFailures < 1 || c.LoginMaxFailuresPerIP < 1 {
+		addProblem("LOGIN_MAX_FAILURES and LOGIN_MAX_FAILURES_PER_IP must be at least 1")
+	}
+	if c.LoginLockoutBase <= 0 || c.LoginLockoutMax < c.LoginLockoutBase {
+		addProblem("LOGIN_LOCKOUT_BASE must be positive and no longer than LOGIN_LOCKOUT_MAX")
+	}
+	if publicURL, err := url.Parse(c.PublicURL); err != nil || publicURL.Scheme == "" || publicURL.Host == "" {
+		addProblem("PUBLIC_URL must be an absolute URL, got %q", c.PublicURL)
+	}
+	if c.Mailer != MailerLog && c.Mailer != MailerFile {
+		addProblem("MAILER must be %q or %q, got %q", MailerLog, MailerFile, c.Mailer)
+	}
+	// Logged emails carry password reset and verification links.
+	if c.Mailer == MailerLog && c.Platform != PlatformDev {
+		addProblem("MAILER %q is only allowed with PLATFORM %q", MailerLog, PlatformDev)
+	}
+	if c.PasswordResetTTL <= 0 || c.EmailVerificationTTL <= 0 {
+		addProblem("PASSWORD_RESET_TTL and EMAIL_VERIFICATION_TTL must be positive")
+	}
+	if c.SubscriptionSweepInterval <= 0 {
+		addProblem("SUBSCRIPTION_SWEEP_INTERVAL must be positive")
+	}
+	if c.WebhookEventSweepInterval <= 0 {
+		addProblem("WEBHOOK_EVENT_SWEEP_INTERVAL must be positive")
+	}
+	if c.RevocationCacheTTL <= 0 || c.RevocationSweepInterval <= 0 {
+		addProblem("REVOCATION_CACHE_TTL and REVOCATION_SWEEP_INTERVAL must be positive")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(problems...))
+	}
+	return nil
+}
+
+// ValidateDBURL checks that DBURL is a postgres URL. The migrate command only
+// needs this part of the configuration.
+func (c Config) ValidateDBURL() error {
+	if c.DBURL == "" {
+		return errors.New("DB_URL is required")
+	}
+	parsed, err := url.Parse(c.DBURL.Value())
+	if err != nil {
+		return errors.New("DB_URL is not a valid URL")
+	}
+	if parsed.Scheme != "postgres" && parsed.Scheme != "postgresql" {
+		return fmt.Errorf("DB_URL must use the postgres scheme, got %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return errors.New("DB_URL has no host")
+	}
+	return nil
+}
+
+// String lists every setting, one per line, with secrets redacted.
+func (c Config) String() string {
+	var out strings.Builder
+	for _, s := range settings {
+		fmt.Fprintf(&out, "%s=%v\n", s.name, displayValue(s.value(&c)))
+	}
+	return out.String()
+}
+
+// LogValue logs the configuration as a group, with secrets redacted.
+func (c Config) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(settings))
+	for _, s := range settings {
+		attrs = append(attrs, slog.Any(s.fileKey(), displayValue(s.value(&c))))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func displayValue(target any) any {
+	switch target := target.(type) {
+	case *string:
+		return *target
+	case *Secret:
+		return target.String()
+	case *int:
+		return *target
+	case *bool:
+		return *target
+	case *time.Duration:
+		return *target
+	}
+	return nil
+}
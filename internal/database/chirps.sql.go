@@ -7,23 +7,61 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countRepliesByChirpIDs = `-- name: CountRepliesByChirpIDs :many
+SELECT in_reply_to, COUNT(*) AS reply_count FROM chirps
+WHERE in_reply_to = ANY($1::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to
+`
+
+type CountRepliesByChirpIDsRow struct {
+	InReplyTo  uuid.NullUUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountRepliesByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]CountRepliesByChirpIDsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countRepliesByChirpIDs, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountRepliesByChirpIDsRow
+	for rows.Next() {
+		var i CountRepliesByChirpIDsRow
+		if err := rows.Scan(&i.InReplyTo, &i.ReplyCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.InReplyTo)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,16 +69,21 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const deleteChirpByID = `-- name: DeleteChirpByID :one
-DELETE FROM chirps
-WHERE id = $1
-RETURNING id, created_at, updated_at, body, user_id
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
 `
 
+// The row stays behind as a tombstone, so replies keep their place in the
+// thread, but the body is gone.
 func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	row := q.db.QueryRowContext(ctx, deleteChirpByID, id)
 	var i Chirp
@@ -50,13 +93,15 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) (Chirp, err
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -68,12 +113,78 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getChirpThread = `-- name: GetChirpThread :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.in_reply_to FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+), thread AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, 0 AS depth FROM chirps
+    WHERE chirps.id = (SELECT ancestors.id FROM ancestors WHERE ancestors.in_reply_to IS NULL)
+    UNION ALL
+    SELECT reply.id, reply.created_at, reply.updated_at, reply.body, reply.user_id, reply.in_reply_to, reply.deleted_at, thread.depth + 1 FROM chirps reply
+    JOIN thread ON reply.in_reply_to = thread.id
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, depth FROM thread
+ORDER BY depth, created_at, id
+`
+
+type GetChirpThreadRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+	Depth     int32
+}
+
+// Every chirp in the conversation that $1 is part of, tombstones included,
+// with its depth below the chirp that started the conversation.
+func (q *Queries) GetChirpThread(ctx context.Context, id uuid.UUID) ([]GetChirpThreadRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpThread, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpThreadRow
+	for rows.Next() {
+		var i GetChirpThreadRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at
 `
 
@@ -92,6 +203,118 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) > ($2, $3::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          sql.NullInt32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2, $3::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           sql.NullInt32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const refreshTokenLifetime = 60 * 24 * time.Hour
+
+// MemoryStore is a Store that keeps everything in process memory. It mirrors
+// the Postgres schema closely enough for handlers to be exercised without a
+// database: emails are unique, deleting a user cascades to every row that
+// references it, and lookups that find nothing return sql.ErrNoRows.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu sync.RWMutex
+	users []User
+	chirps []Chirp
+	chirpLikes []ChirpLike
+	refreshTokens []RefreshToken
+	webhookEvents []WebhookEvent
+	subscriptions []Subscription
+	subscriptionEvents []SubscriptionEvent
+	loginThrottles []LoginThrottle
+	loginLockoutEvents []LoginLockoutEvent
+	passwordResetTokens []PasswordResetToken
+	emailVerificationTokens []EmailVerificationToken
+	userTOTP []UserTotp
+	totpRecoveryCodes []TotpRecoveryCode
+	apiKeys []ApiKey
+	revokedAccessTokens []RevokedAccessToken
+	follows []Follow
+	userBlocks []UserBlock
+	userMutes []UserMute
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// now is what NOW() writes to a Postgres TIMESTAMP column: the wall clock in
+// the session's time zone, which here is the local one.
+func now() time.Time {
+	return timestamp(time.Now())
+}
+
+// timestamp is what a Postgres TIMESTAMP column keeps of t: its wall clock, to
+// the microsecond, without its time zone.
+func timestamp(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).Truncate(time.Microsecond)
+}
+
+func (m *MemoryStore) userIndex(id uuid.UUID) int {
+	return slices.IndexFunc(m.users, func(u User) bool { return u.ID == id })
+}
+
+func (m *MemoryStore) emailTaken(email string, except uuid.UUID) bool {
+	return slices.ContainsFunc(m.users, func(u User) bool { return u.Email == email && u.ID != except })
+}
+
+func (m *MemoryStore) DeleteUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Every other table references users with ON DELETE CASCADE.
+	m.users = nil
+	m.chirps = nil
+	m.chirpLikes = nil
+	m.refreshTokens = nil
+	m.subscriptions = nil
+	m.subscriptionEvents = nil
+	m.passwordResetTokens = nil
+	m.emailVerificationTokens = nil
+	m.userTOTP = nil
+	m.totpRecoveryCodes = nil
+	m.apiKeys = nil
+	m.revokedAccessTokens = nil
+	m.follows = nil
+	m.userBlocks = nil
+	m.userMutes = nil
+	// Throttles keyed by IP address have no user and survive.
+	m.loginThrottles = slices.DeleteFunc(m.loginThrottles, func(t LoginThrottle) bool { return t.UserID.Valid })
+	m.loginLockoutEvents = slices.DeleteFunc(m.loginLockoutEvents, func(e LoginLockoutEvent) bool { return e.UserID.Valid })
+	return nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return ApiKey{}, foreignKeyViolation("api_keys", "fk_user_id")
+	}
+	if slices.ContainsFunc(m.apiKeys, func(k ApiKey) bool { return k.KeyHash == arg.KeyHash }) {
+		return ApiKey{}, uniqueViolation("api_keys_key_hash_key")
+	}
+	key := ApiKey{
+		ID: uuid.New(),
+		UserID: arg.UserID,
+		Name: arg.Name,
+		KeyHash: arg.KeyHash,
+		Prefix: arg.Prefix,
+		Scopes: slices.Clone(arg.Scopes),
+		CreatedAt: now(),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.apiKeys = append(m.apiKeys, key)
+	return key, nil
+}
+
+func (m *MemoryStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := slices.IndexFunc(m.apiKeys, func(k ApiKey) bool { return k.KeyHash == keyHash })
+	if i < 0 {
+		return ApiKey{}, sql.ErrNoRows
+	}
+	return m.apiKeys[i], nil
+}
+
+func (m *MemoryStore) ListAPIKeysByUserID(ctx context.Context, userID uuid.UUID) ([]ApiKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []ApiKey
+	for _, key := range m.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortStableFunc(keys, func(a, b ApiKey) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return keys, nil
+}
+
+func (m *MemoryStore) RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == arg.ID && m.apiKeys[i].UserID == arg.UserID && !m.apiKeys[i].RevokedAt.Valid {
+			m.apiKeys[i].RevokedAt = sql.NullTime{Time: now(), Valid: true}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *MemoryStore) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.apiKeys, func(k ApiKey) bool { return k.ID == id })
+	if i < 0 {
+		return nil
+	}
+	current := now()
+	if !m.apiKeys[i].LastUsedAt.Valid || m.apiKeys[i].LastUsedAt.Time.Before(current.Add(-time.Minute)) {
+		m.apiKeys[i].LastUsedAt = sql.NullTime{Time: current, Valid: true}
+	}
+	return nil
+}
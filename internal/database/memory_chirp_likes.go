@@ -0,0 +1,84 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) CountLikesByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]CountLikesByChirpIDsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[uuid.UUID]int64{}
+	for _, like := range m.chirpLikes {
+		if slices.Contains(chirpIds, like.ChirpID) {
+			counts[like.ChirpID]++
+		}
+	}
+	var rows []CountLikesByChirpIDsRow
+	for chirpID, count := range counts {
+		rows = append(rows, CountLikesByChirpIDsRow{ChirpID: chirpID, LikeCount: count})
+	}
+	return rows, nil
+}
+
+func (m *MemoryStore) LikeChirp(ctx context.Context, arg LikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return foreignKeyViolation("chirp_likes", "fk_user_id")
+	}
+	if m.chirpIndex(arg.ChirpID) < 0 {
+		return foreignKeyViolation("chirp_likes", "fk_chirp_id")
+	}
+	if slices.ContainsFunc(m.chirpLikes, func(l ChirpLike) bool { return l.UserID == arg.UserID && l.ChirpID == arg.ChirpID }) {
+		return nil
+	}
+	m.chirpLikes = append(m.chirpLikes, ChirpLike{UserID: arg.UserID, ChirpID: arg.ChirpID, CreatedAt: now()})
+	return nil
+}
+
+func (m *MemoryStore) ListChirpIDsLikedByUser(ctx context.Context, arg ListChirpIDsLikedByUserParams) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var chirpIDs []uuid.UUID
+	for _, like := range m.chirpLikes {
+		if like.UserID == arg.UserID && slices.Contains(arg.ChirpIds, like.ChirpID) {
+			chirpIDs = append(chirpIDs, like.ChirpID)
+		}
+	}
+	return chirpIDs, nil
+}
+
+func (m *MemoryStore) ListChirpsLikedByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var likes []ChirpLike
+	for _, like := range m.chirpLikes {
+		if like.UserID == userID {
+			likes = append(likes, like)
+		}
+	}
+	slices.SortFunc(likes, func(a, b ChirpLike) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(b.ChirpID[:], a.ChirpID[:])
+	})
+	var chirps []Chirp
+	for _, like := range likes {
+		if i := m.liveChirpIndex(like.ChirpID); i >= 0 {
+			chirps = append(chirps, m.chirps[i])
+		}
+	}
+	return chirps, nil
+}
+
+func (m *MemoryStore) UnlikeChirp(ctx context.Context, arg UnlikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chirpLikes = slices.DeleteFunc(m.chirpLikes, func(l ChirpLike) bool { return l.UserID == arg.UserID && l.ChirpID == arg.ChirpID })
+	return nil
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) chirpIndex(id uuid.UUID) int {
+	return slices.IndexFunc(m.chirps, func(c Chirp) bool { return c.ID == id })
+}
+
+// liveChirpIndex is chirpIndex without tombstones.
+func (m *MemoryStore) liveChirpIndex(id uuid.UUID) int {
+	return slices.IndexFunc(m.chirps, func(c Chirp) bool { return c.ID == id && !c.DeletedAt.Valid })
+}
+
+func (m *MemoryStore) CountRepliesByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]CountRepliesByChirpIDsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[uuid.UUID]int64{}
+	for _, chirp := range m.chirps {
+		if chirp.InReplyTo.Valid && !chirp.DeletedAt.Valid && slices.Contains(chirpIds, chirp.InReplyTo.UUID) {
+			counts[chirp.InReplyTo.UUID]++
+		}
+	}
+	var rows []CountRepliesByChirpIDsRow
+	for chirpID, count := range counts {
+		rows = append(rows, CountRepliesByChirpIDsRow{InReplyTo: uuid.NullUUID{UUID: chirpID, Valid: true}, ReplyCount: count})
+	}
+	return rows, nil
+}
+
+func (m *MemoryStore) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return Chirp{}, foreignKeyViolation("chirps", "fk_user_id")
+	}
+	if arg.InReplyTo.Valid && m.chirpIndex(arg.InReplyTo.UUID) < 0 {
+		return Chirp{}, foreignKeyViolation("chirps", "fk_in_reply_to")
+	}
+	t := now()
+	chirp := Chirp{
+		ID: uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body: arg.Body,
+		UserID: arg.UserID,
+		InReplyTo: arg.InReplyTo,
+	}
+	m.chirps = append(m.chirps, chirp)
+	return chirp, nil
+}
+
+func (m *MemoryStore) DeleteChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.liveChirpIndex(id)
+	if i < 0 {
+		return Chirp{}, sql.ErrNoRows
+	}
+	t := now()
+	m.chirps[i].Body = ""
+	m.chirps[i].DeletedAt = sql.NullTime{Time: t, Valid: true}
+	m.chirps[i].UpdatedAt = t
+	return m.chirps[i], nil
+}
+
+func (m *MemoryStore) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.liveChirpIndex(id)
+	if i < 0 {
+		return Chirp{}, sql.ErrNoRows
+	}
+	return m.chirps[i], nil
+}
+
+func (m *MemoryStore) GetChirpThread(ctx context.Context, id uuid.UUID) ([]GetChirpThreadRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.chirpIndex(id)
+	if i < 0 {
+		return nil, nil
+	}
+	for m.chirps[i].InReplyTo.Valid {
+		i = m.chirpIndex(m.chirps[i].InReplyTo.UUID)
+	}
+
+	var thread []GetChirpThreadRow
+	level := []uuid.UUID{m.chirps[i].ID}
+	for depth := int32(0); len(level) > 0; depth++ {
+		var rows []GetChirpThreadRow
+		for _, chirp := range m.chirps {
+			if slices.Contains(level, chirp.ID) {
+				rows = append(rows, GetChirpThreadRow{
+					ID: chirp.ID,
+					CreatedAt: chirp.CreatedAt,
+					UpdatedAt: chirp.UpdatedAt,
+					Body: chirp.Body,
+					UserID: chirp.UserID,
+					InReplyTo: chirp.InReplyTo,
+					DeletedAt: chirp.DeletedAt,
+					Depth: depth,
+				})
+			}
+		}
+		slices.SortFunc(rows, func(a, b GetChirpThreadRow) int {
+			if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+				return c
+			}
+			return bytes.Compare(a.ID[:], b.ID[:])
+		})
+		thread = append(thread, rows...)
+		level = nil
+		for _, chirp := range m.chirps {
+			if chirp.InReplyTo.Valid && slices.ContainsFunc(rows, func(r GetChirpThreadRow) bool { return r.ID == chirp.InReplyTo.UUID }) {
+				level = append(level, chirp.ID)
+			}
+		}
+	}
+	return thread, nil
+}
+
+func (m *MemoryStore) GetChirps(ctx context.Context) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirps := slices.DeleteFunc(slices.Clone(m.chirps), func(c Chirp) bool { return c.DeletedAt.Valid })
+	if len(chirps) == 0 {
+		return nil, nil
+	}
+	slices.SortStableFunc(chirps, func(a, b Chirp) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return chirps, nil
+}
+
+func (m *MemoryStore) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	return m.listChirps(byAuthor(arg.AuthorID), arg.AfterCreatedAt, arg.AfterID, arg.Limit, false)
+}
+
+func (m *MemoryStore) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	return m.listChirps(byAuthor(arg.AuthorID), arg.BeforeCreatedAt, arg.BeforeID, arg.Limit, true)
+}
+
+func byAuthor(authorID uuid.NullUUID) func(Chirp) bool {
+	return func(c Chirp) bool { return !authorID.Valid || c.UserID == authorID.UUID }
+}
+
+// listChirps pages through the live chirps that keep accepts, ordered by
+// (created_at, id), starting strictly after the cursor in the direction of the
+// ordering. keep is called with the store locked.
+func (m *MemoryStore) listChirps(keep func(Chirp) bool, cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, limit sql.NullInt32, desc bool) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	compare := func(a, b Chirp) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.ID[:], b.ID[:])
+	}
+	cursor := Chirp{CreatedAt: cursorCreatedAt.Time, ID: cursorID.UUID}
+
+	var chirps []Chirp
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid || !keep(chirp) {
+			continue
+		}
+		if cursorCreatedAt.Valid {
+			c := compare(chirp, cursor)
+			if (!desc && c <= 0) || (desc && c >= 0) {
+				continue
+			}
+		}
+		chirps = append(chirps, chirp)
+	}
+	slices.SortFunc(chirps, func(a, b Chirp) int {
+		if desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+	if limit.Valid && int(limit.Int32) < len(chirps) {
+		chirps = chirps[:limit.Int32]
+	}
+	return chirps, nil
+}
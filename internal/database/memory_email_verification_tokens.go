@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+)
+
+func (m *MemoryStore) ConsumeEmailVerificationToken(ctx context.Context, arg ConsumeEmailVerificationTokenParams) (EmailVerificationToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := timestamp(arg.Now)
+	i := slices.IndexFunc(m.emailVerificationTokens, func(e EmailVerificationToken) bool {
+		return e.TokenHash == arg.TokenHash && !e.UsedAt.Valid && e.ExpiresAt.After(t)
+	})
+	if i < 0 {
+		return EmailVerificationToken{}, sql.ErrNoRows
+	}
+	m.emailVerificationTokens[i].UsedAt = sql.NullTime{Time: t, Valid: true}
+	return m.emailVerificationTokens[i], nil
+}
+
+func (m *MemoryStore) CreateEmailVerificationToken(ctx context.Context, arg CreateEmailVerificationTokenParams) (EmailVerificationToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return EmailVerificationToken{}, foreignKeyViolation("email_verification_tokens", "fk_user_id")
+	}
+	if slices.ContainsFunc(m.emailVerificationTokens, func(e EmailVerificationToken) bool { return e.TokenHash == arg.TokenHash }) {
+		return EmailVerificationToken{}, uniqueViolation("email_verification_tokens_pkey")
+	}
+	token := EmailVerificationToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: now(),
+		UserID: arg.UserID,
+		Email: arg.Email,
+		ExpiresAt: timestamp(arg.ExpiresAt),
+	}
+	m.emailVerificationTokens = append(m.emailVerificationTokens, token)
+	return token, nil
+}
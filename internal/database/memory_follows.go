@@ -0,0 +1,158 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) BlockUser(ctx context.Context, arg BlockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.BlockerID) < 0 {
+		return foreignKeyViolation("user_blocks", "fk_blocker_id")
+	}
+	if m.userIndex(arg.BlockedID) < 0 {
+		return foreignKeyViolation("user_blocks", "fk_blocked_id")
+	}
+	if arg.BlockerID == arg.BlockedID {
+		return checkViolation("user_blocks", "user_blocks_not_self")
+	}
+	m.follows = slices.DeleteFunc(m.follows, func(f Follow) bool {
+		return (f.FollowerID == arg.BlockerID && f.FolloweeID == arg.BlockedID) ||
+			(f.FollowerID == arg.BlockedID && f.FolloweeID == arg.BlockerID)
+	})
+	if m.blocked(arg.BlockerID, arg.BlockedID) {
+		return nil
+	}
+	m.userBlocks = append(m.userBlocks, UserBlock{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID, CreatedAt: now()})
+	return nil
+}
+
+func (m *MemoryStore) blocked(blockerID, blockedID uuid.UUID) bool {
+	return slices.ContainsFunc(m.userBlocks, func(b UserBlock) bool { return b.BlockerID == blockerID && b.BlockedID == blockedID })
+}
+
+func (m *MemoryStore) FollowUser(ctx context.Context, arg FollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.FollowerID) < 0 {
+		return foreignKeyViolation("follows", "fk_follower_id")
+	}
+	if m.userIndex(arg.FolloweeID) < 0 {
+		return foreignKeyViolation("follows", "fk_followee_id")
+	}
+	if arg.FollowerID == arg.FolloweeID {
+		return checkViolation("follows", "follows_not_self")
+	}
+	if slices.ContainsFunc(m.follows, func(f Follow) bool { return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID }) {
+		return nil
+	}
+	m.follows = append(m.follows, Follow{FollowerID: arg.FollowerID, FolloweeID: arg.FolloweeID, CreatedAt: now()})
+	return nil
+}
+
+func (m *MemoryStore) IsBlockedBetween(ctx context.Context, arg IsBlockedBetweenParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.blocked(arg.UserID, arg.OtherUserID) || m.blocked(arg.OtherUserID, arg.UserID), nil
+}
+
+// listFollows returns the follows that match, newest first, breaking ties on
+// the user at the other end.
+func (m *MemoryStore) listFollows(match func(Follow) bool, other func(Follow) uuid.UUID) []Follow {
+	var follows []Follow
+	for _, follow := range m.follows {
+		if match(follow) {
+			follows = append(follows, follow)
+		}
+	}
+	slices.SortFunc(follows, func(a, b Follow) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		aID, bID := other(a), other(b)
+		return bytes.Compare(bID[:], aID[:])
+	})
+	return follows
+}
+
+func (m *MemoryStore) ListFollowers(ctx context.Context, followeeID uuid.UUID) ([]ListFollowersRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []ListFollowersRow
+	follows := m.listFollows(
+		func(f Follow) bool { return f.FolloweeID == followeeID },
+		func(f Follow) uuid.UUID { return f.FollowerID },
+	)
+	for _, follow := range follows {
+		rows = append(rows, ListFollowersRow{UserID: follow.FollowerID, CreatedAt: follow.CreatedAt})
+	}
+	return rows, nil
+}
+
+func (m *MemoryStore) ListFollowing(ctx context.Context, followerID uuid.UUID) ([]ListFollowingRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []ListFollowingRow
+	follows := m.listFollows(
+		func(f Follow) bool { return f.FollowerID == followerID },
+		func(f Follow) uuid.UUID { return f.FolloweeID },
+	)
+	for _, follow := range follows {
+		rows = append(rows, ListFollowingRow{UserID: follow.FolloweeID, CreatedAt: follow.CreatedAt})
+	}
+	return rows, nil
+}
+
+func (m *MemoryStore) ListTimeline(ctx context.Context, arg ListTimelineParams) ([]Chirp, error) {
+	keep := func(c Chirp) bool {
+		following := slices.ContainsFunc(m.follows, func(f Follow) bool { return f.FollowerID == arg.UserID && f.FolloweeID == c.UserID })
+		muted := slices.ContainsFunc(m.userMutes, func(u UserMute) bool { return u.MuterID == arg.UserID && u.MutedID == c.UserID })
+		return following && !muted && !m.blocked(arg.UserID, c.UserID) && !m.blocked(c.UserID, arg.UserID)
+	}
+	return m.listChirps(keep, arg.BeforeCreatedAt, arg.BeforeID, sql.NullInt32{Int32: arg.Limit, Valid: true}, true)
+}
+
+func (m *MemoryStore) MuteUser(ctx context.Context, arg MuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.MuterID) < 0 {
+		return foreignKeyViolation("user_mutes", "fk_muter_id")
+	}
+	if m.userIndex(arg.MutedID) < 0 {
+		return foreignKeyViolation("user_mutes", "fk_muted_id")
+	}
+	if arg.MuterID == arg.MutedID {
+		return checkViolation("user_mutes", "user_mutes_not_self")
+	}
+	if slices.ContainsFunc(m.userMutes, func(u UserMute) bool { return u.MuterID == arg.MuterID && u.MutedID == arg.MutedID }) {
+		return nil
+	}
+	m.userMutes = append(m.userMutes, UserMute{MuterID: arg.MuterID, MutedID: arg.MutedID, CreatedAt: now()})
+	return nil
+}
+
+func (m *MemoryStore) UnblockUser(ctx context.Context, arg UnblockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userBlocks = slices.DeleteFunc(m.userBlocks, func(b UserBlock) bool { return b.BlockerID == arg.BlockerID && b.BlockedID == arg.BlockedID })
+	return nil
+}
+
+func (m *MemoryStore) UnfollowUser(ctx context.Context, arg UnfollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.follows = slices.DeleteFunc(m.follows, func(f Follow) bool { return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID })
+	return nil
+}
+
+func (m *MemoryStore) UnmuteUser(ctx context.Context, arg UnmuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userMutes = slices.DeleteFunc(m.userMutes, func(u UserMute) bool { return u.MuterID == arg.MuterID && u.MutedID == arg.MutedID })
+	return nil
+}
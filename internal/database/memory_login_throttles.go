@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) loginThrottleIndex(key string) int {
+	return slices.IndexFunc(m.loginThrottles, func(t LoginThrottle) bool { return t.Key == key })
+}
+
+func (m *MemoryStore) CreateLoginLockoutEvent(ctx context.Context, arg CreateLoginLockoutEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if arg.UserID.Valid && m.userIndex(arg.UserID.UUID) < 0 {
+		return foreignKeyViolation("login_lockout_events", "fk_user_id")
+	}
+	m.loginLockoutEvents = append(m.loginLockoutEvents, LoginLockoutEvent{
+		ID: uuid.New(),
+		CreatedAt: now(),
+		ThrottleKey: arg.ThrottleKey,
+		UserID: arg.UserID,
+		Event: arg.Event,
+		FailedAttempts: arg.FailedAttempts,
+		LockedUntil: arg.LockedUntil,
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteLoginThrottle(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.loginThrottleIndex(key)
+	if i < 0 {
+		return 0, nil
+	}
+	m.loginThrottles = slices.Delete(m.loginThrottles, i, i+1)
+	return 1, nil
+}
+
+func (m *MemoryStore) GetLoginLockoutEventsByUserID(ctx context.Context, userID uuid.NullUUID) ([]LoginLockoutEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var events []LoginLockoutEvent
+	for i := len(m.loginLockoutEvents) - 1; i >= 0 && len(events) < 50; i-- {
+		// NULL never equals NULL in SQL.
+		if userID.Valid && m.loginLockoutEvents[i].UserID == userID {
+			events = append(events, m.loginLockoutEvents[i])
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) GetLoginThrottle(ctx context.Context, key string) (LoginThrottle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.loginThrottleIndex(key)
+	if i < 0 {
+		return LoginThrottle{}, sql.ErrNoRows
+	}
+	return m.loginThrottles[i], nil
+}
+
+func (m *MemoryStore) LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) (LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.loginThrottleIndex(arg.Key)
+	if i < 0 {
+		return LoginThrottle{}, sql.ErrNoRows
+	}
+	m.loginThrottles[i].FailedAttempts = 0
+	m.loginThrottles[i].Lockouts++
+	m.loginThrottles[i].LockedUntil = arg.LockedUntil
+	m.loginThrottles[i].UpdatedAt = timestamp(arg.UpdatedAt)
+	return m.loginThrottles[i], nil
+}
+
+func (m *MemoryStore) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := timestamp(arg.Now)
+	i := m.loginThrottleIndex(arg.Key)
+	if i < 0 {
+		if arg.UserID.Valid && m.userIndex(arg.UserID.UUID) < 0 {
+			return LoginThrottle{}, foreignKeyViolation("login_throttles", "fk_user_id")
+		}
+		m.loginThrottles = append(m.loginThrottles, LoginThrottle{
+			Key: arg.Key,
+			UserID: arg.UserID,
+			CreatedAt: t,
+			UpdatedAt: t,
+			FailedAttempts: 1,
+		})
+		return m.loginThrottles[len(m.loginThrottles)-1], nil
+	}
+	throttle := &m.loginThrottles[i]
+	if throttle.UpdatedAt.Before(timestamp(arg.StaleBefore)) {
+		throttle.FailedAttempts = 1
+		throttle.Lockouts = 0
+	} else {
+		throttle.FailedAttempts++
+	}
+	throttle.UpdatedAt = t
+	return *throttle, nil
+}
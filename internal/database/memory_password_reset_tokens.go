@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) ConsumePasswordResetToken(ctx context.Context, arg ConsumePasswordResetTokenParams) (PasswordResetToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := timestamp(arg.Now)
+	i := slices.IndexFunc(m.passwordResetTokens, func(p PasswordResetToken) bool {
+		return p.TokenHash == arg.TokenHash && !p.UsedAt.Valid && p.ExpiresAt.After(t)
+	})
+	if i < 0 {
+		return PasswordResetToken{}, sql.ErrNoRows
+	}
+	m.passwordResetTokens[i].UsedAt = sql.NullTime{Time: t, Valid: true}
+	return m.passwordResetTokens[i], nil
+}
+
+func (m *MemoryStore) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return PasswordResetToken{}, foreignKeyViolation("password_reset_tokens", "fk_user_id")
+	}
+	if slices.ContainsFunc(m.passwordResetTokens, func(p PasswordResetToken) bool { return p.TokenHash == arg.TokenHash }) {
+		return PasswordResetToken{}, uniqueViolation("password_reset_tokens_pkey")
+	}
+	token := PasswordResetToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: now(),
+		UserID: arg.UserID,
+		ExpiresAt: timestamp(arg.ExpiresAt),
+	}
+	m.passwordResetTokens = append(m.passwordResetTokens, token)
+	return token, nil
+}
+
+func (m *MemoryStore) DeletePasswordResetTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.passwordResetTokens = slices.DeleteFunc(m.passwordResetTokens, func(p PasswordResetToken) bool { return p.UserID == userID })
+	return nil
+}
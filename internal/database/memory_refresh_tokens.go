@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	i := slices.IndexFunc(m.refreshTokens, func(r RefreshToken) bool {
+		return r.TokenHash == tokenHash && !r.RevokedAt.Valid && r.ExpiresAt.After(t)
+	})
+	if i < 0 {
+		return RefreshToken{}, sql.ErrNoRows
+	}
+	m.refreshTokens[i].RevokedAt = sql.NullTime{Time: t, Valid: true}
+	m.refreshTokens[i].UpdatedAt = t
+	return m.refreshTokens[i], nil
+}
+
+func (m *MemoryStore) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return RefreshToken{}, foreignKeyViolation("refresh_tokens", "fk_user_id")
+	}
+	if slices.ContainsFunc(m.refreshTokens, func(r RefreshToken) bool { return r.TokenHash == arg.TokenHash }) {
+		return RefreshToken{}, uniqueViolation("refresh_tokens_pkey")
+	}
+	t := now()
+	token := RefreshToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID: arg.UserID,
+		ExpiresAt: t.Add(refreshTokenLifetime),
+		FamilyID: arg.FamilyID,
+		UserAgent: arg.UserAgent,
+		IpAddress: arg.IpAddress,
+		LastUsedAt: t,
+	}
+	m.refreshTokens = append(m.refreshTokens, token)
+	return token, nil
+}
+
+func (m *MemoryStore) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := slices.IndexFunc(m.refreshTokens, func(r RefreshToken) bool { return r.TokenHash == tokenHash })
+	if i < 0 {
+		return RefreshToken{}, sql.ErrNoRows
+	}
+	return m.refreshTokens[i], nil
+}
+
+func (m *MemoryStore) ListSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]ListSessionsByUserIDRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t := now()
+	var sessions []ListSessionsByUserIDRow
+	for _, r := range m.refreshTokens {
+		if r.UserID != userID || r.RevokedAt.Valid || !r.ExpiresAt.After(t) {
+			continue
+		}
+		signedInAt := r.CreatedAt
+		for _, f := range m.refreshTokens {
+			if f.FamilyID == r.FamilyID && f.CreatedAt.Before(signedInAt) {
+				signedInAt = f.CreatedAt
+			}
+		}
+		sessions = append(sessions, ListSessionsByUserIDRow{
+			TokenHash: r.TokenHash,
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+			UserID: r.UserID,
+			ExpiresAt: r.ExpiresAt,
+			RevokedAt: r.RevokedAt,
+			FamilyID: r.FamilyID,
+			UserAgent: r.UserAgent,
+			IpAddress: r.IpAddress,
+			LastUsedAt: r.LastUsedAt,
+			SignedInAt: signedInAt,
+		})
+	}
+	slices.SortStableFunc(sessions, func(a, b ListSessionsByUserIDRow) int { return b.LastUsedAt.Compare(a.LastUsedAt) })
+	return sessions, nil
+}
+
+func (m *MemoryStore) RevokeOtherRefreshTokensByUserID(ctx context.Context, arg RevokeOtherRefreshTokensByUserIDParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for i := range m.refreshTokens {
+		if m.refreshTokens[i].UserID == arg.UserID && m.refreshTokens[i].FamilyID != arg.FamilyID && !m.refreshTokens[i].RevokedAt.Valid {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: t, Valid: true}
+			m.refreshTokens[i].UpdatedAt = t
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for i := range m.refreshTokens {
+		if m.refreshTokens[i].TokenHash == tokenHash {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: t, Valid: true}
+			m.refreshTokens[i].UpdatedAt = t
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for i := range m.refreshTokens {
+		if m.refreshTokens[i].FamilyID == familyID && !m.refreshTokens[i].RevokedAt.Valid {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: t, Valid: true}
+			m.refreshTokens[i].UpdatedAt = t
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RevokeRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for i := range m.refreshTokens {
+		if m.refreshTokens[i].UserID == userID && !m.refreshTokens[i].RevokedAt.Valid {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: t, Valid: true}
+			m.refreshTokens[i].UpdatedAt = t
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	var revoked int64
+	for i := range m.refreshTokens {
+		if m.refreshTokens[i].FamilyID == arg.FamilyID && m.refreshTokens[i].UserID == arg.UserID && !m.refreshTokens[i].RevokedAt.Valid {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: t, Valid: true}
+			m.refreshTokens[i].UpdatedAt = t
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (m *MemoryStore) TouchSession(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for i := range m.refreshTokens {
+		r := &m.refreshTokens[i]
+		if r.FamilyID == familyID && !r.RevokedAt.Valid && r.LastUsedAt.Before(t.Add(-time.Minute)) {
+			r.LastUsedAt = t
+		}
+	}
+	return nil
+}
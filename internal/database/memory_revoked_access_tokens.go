@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (m *MemoryStore) CreateRevokedAccessToken(ctx context.Context, arg CreateRevokedAccessTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return foreignKeyViolation("revoked_access_tokens", "fk_user_id")
+	}
+	if slices.ContainsFunc(m.revokedAccessTokens, func(r RevokedAccessToken) bool { return r.Jti == arg.Jti }) {
+		return nil
+	}
+	m.revokedAccessTokens = append(m.revokedAccessTokens, RevokedAccessToken{
+		Jti: arg.Jti,
+		UserID: arg.UserID,
+		RevokedAt: now(),
+		ExpiresAt: timestamp(arg.ExpiresAt),
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpiredRevokedAccessTokens(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := timestamp(cutoff)
+	before := len(m.revokedAccessTokens)
+	m.revokedAccessTokens = slices.DeleteFunc(m.revokedAccessTokens, func(r RevokedAccessToken) bool { return r.ExpiresAt.Before(t) })
+	return int64(before - len(m.revokedAccessTokens)), nil
+}
+
+func (m *MemoryStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.ContainsFunc(m.revokedAccessTokens, func(r RevokedAccessToken) bool { return r.Jti == jti }), nil
+}
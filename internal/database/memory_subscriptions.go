@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) CreateSubscriptionEvent(ctx context.Context, arg CreateSubscriptionEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return foreignKeyViolation("subscription_events", "fk_user_id")
+	}
+	m.subscriptionEvents = append(m.subscriptionEvents, SubscriptionEvent{
+		ID: uuid.New(),
+		CreatedAt: now(),
+		UserID: arg.UserID,
+		Event: arg.Event,
+		PeriodStart: arg.PeriodStart,
+		PeriodEnd: arg.PeriodEnd,
+	})
+	return nil
+}
+
+func (m *MemoryStore) ExpireSubscriptions(ctx context.Context, cutoff time.Time) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	cutoff = timestamp(cutoff)
+	var expired []Subscription
+	for i := range m.subscriptions {
+		if m.subscriptions[i].Status == "active" && m.subscriptions[i].CurrentPeriodEnd.Before(cutoff) {
+			m.subscriptions[i].Status = "expired"
+			m.subscriptions[i].UpdatedAt = t
+			expired = append(expired, m.subscriptions[i])
+		}
+	}
+	return expired, nil
+}
+
+func (m *MemoryStore) GetSubscriptionByUserID(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := slices.IndexFunc(m.subscriptions, func(s Subscription) bool { return s.UserID == userID })
+	if i < 0 {
+		return Subscription{}, sql.ErrNoRows
+	}
+	return m.subscriptions[i], nil
+}
+
+func (m *MemoryStore) GetSubscriptionEventsByUserID(ctx context.Context, userID uuid.UUID) ([]SubscriptionEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var events []SubscriptionEvent
+	for i := len(m.subscriptionEvents) - 1; i >= 0 && len(events) < 50; i-- {
+		if m.subscriptionEvents[i].UserID == userID {
+			events = append(events, m.subscriptionEvents[i])
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) UpdateSubscriptionStatus(ctx context.Context, arg UpdateSubscriptionStatusParams) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.subscriptions, func(s Subscription) bool { return s.UserID == arg.UserID })
+	if i < 0 {
+		return Subscription{}, sql.ErrNoRows
+	}
+	m.subscriptions[i].Status = arg.Status
+	m.subscriptions[i].UpdatedAt = now()
+	return m.subscriptions[i], nil
+}
+
+func (m *MemoryStore) UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return Subscription{}, foreignKeyViolation("subscriptions", "fk_user_id")
+	}
+	t := now()
+	i := slices.IndexFunc(m.subscriptions, func(s Subscription) bool { return s.UserID == arg.UserID })
+	if i < 0 {
+		m.subscriptions = append(m.subscriptions, Subscription{UserID: arg.UserID, CreatedAt: t})
+		i = len(m.subscriptions) - 1
+	}
+	m.subscriptions[i].UpdatedAt = t
+	m.subscriptions[i].Status = arg.Status
+	m.subscriptions[i].CurrentPeriodStart = timestamp(arg.CurrentPeriodStart)
+	m.subscriptions[i].CurrentPeriodEnd = timestamp(arg.CurrentPeriodEnd)
+	return m.subscriptions[i], nil
+}
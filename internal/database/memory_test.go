@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryStoreUniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	first, err := store.CreateUser(ctx, CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	second, err := store.CreateUser(ctx, CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+
+	cases := []struct{
+		name string
+		run func() error
+		expectedUnique bool
+	}{
+		{
+			name: "create with taken email",
+			run: func() error {
+				_, err := store.CreateUser(ctx, CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+				return err
+			},
+			expectedUnique: true,
+		},
+		{
+			name: "update to taken email",
+			run: func() error {
+				_, err := store.UpdateUserEmailPasswordByID(ctx, UpdateUserEmailPasswordByIDParams{Email: "a@example.com", ID: second.ID})
+				return err
+			},
+			expectedUnique: true,
+		},
+		{
+			name: "update to own email",
+			run: func() error {
+				_, err := store.UpdateUserEmailPasswordByID(ctx, UpdateUserEmailPasswordByIDParams{Email: "a@example.com", ID: first.ID})
+				return err
+			},
+			expectedUnique: false,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.run()
+		if IsUniqueViolation(err) != c.expectedUnique {
+			t.Errorf("Test failed for case '%s', got error: %v", c.name, err)
+		}
+	}
+}
+
+func TestMemoryStoreNoRows(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	cases := []struct{
+		name string
+		run func() error
+	}{
+		{
+			name: "GetChirp",
+			run: func() error { _, err := store.GetChirp(ctx, uuid.New()); return err },
+		},
+		{
+			name: "DeleteChirpByID",
+			run: func() error { _, err := store.DeleteChirpByID(ctx, uuid.New()); return err },
+		},
+		{
+			name: "GetRefreshToken",
+			run: func() error { _, err := store.GetRefreshToken(ctx, "missing"); return err },
+		},
+		{
+			name: "GetUserFromEmail",
+			run: func() error { _, err := store.GetUserFromEmail(ctx, "missing@example.com"); return err },
+		},
+		{
+			name: "UpgradeUserByID",
+			run: func() error { _, err := store.UpgradeUserByID(ctx, uuid.New()); return err },
+		},
+	}
+
+	for _, c := range cases {
+		if err := c.run(); err != sql.ErrNoRows {
+			t.Errorf("Test failed for %s, expected sql.ErrNoRows but got: %v", c.name, err)
+		}
+	}
+}
+
+func TestMemoryStoreCascade(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	user, err := store.CreateUser(ctx, CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	chirp, err := store.CreateChirp(ctx, CreateChirpParams{Body: "hello", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("could not create chirp: %v", err)
+	}
+	replier, err := store.CreateUser(ctx, CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("could not create user: %v", err)
+	}
+	reply, err := store.CreateChirp(ctx, CreateChirpParams{Body: "hi", UserID: replier.ID, InReplyTo: uuid.NullUUID{UUID: chirp.ID, Valid: true}})
+	if err != nil {
+		t.Fatalf("could not create reply: %v", err)
+	}
+	if _, err := store.CreateRefreshToken(ctx, CreateRefreshTokenParams{TokenHash: "token", UserID: user.ID}); err != nil {
+		t.Fatalf("could not create refresh token: %v", err)
+	}
+	if err := store.LikeChirp(ctx, LikeChirpParams{UserID: user.ID, ChirpID: chirp.ID}); err != nil {
+		t.Fatalf("could not like chirp: %v", err)
+	}
+	if _, err := store.CreateChirp(ctx, CreateChirpParams{Body: "orphan", UserID: uuid.New()}); !IsForeignKeyViolation(err) {
+		t.Errorf("expected foreign key violation for unknown user, got: %v", err)
+	}
+
+	if err := store.DeleteUsers(ctx); err != nil {
+		t.Fatalf("could not delete users: %v", err)
+	}
+	if _, err := store.GetChirp(ctx, chirp.ID); err != sql.ErrNoRows {
+		t.Errorf("expected chirp to be deleted with its user, got: %v", err)
+	}
+	// Deleting every user leaves no reply behind without its parent.
+	if _, err := store.GetChirp(ctx, reply.ID); err != sql.ErrNoRows {
+		t.Errorf("expected reply to be deleted with its user, got: %v", err)
+	}
+	if thread, _ := store.GetChirpThread(ctx, reply.ID); len(thread) != 0 {
+		t.Errorf("expected no thread to be left, got: %+v", thread)
+	}
+	if _, err := store.GetRefreshToken(ctx, "token"); err != sql.ErrNoRows {
+		t.Errorf("expected refresh token to be deleted with its user, got: %v", err)
+	}
+	if counts, _ := store.CountLikesByChirpIDs(ctx, []uuid.UUID{chirp.ID}); len(counts) != 0 {
+		t.Errorf("expected likes to be deleted with their user, got: %+v", counts)
+	}
+}
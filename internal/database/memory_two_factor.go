@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) totpIndex(userID uuid.UUID) int {
+	return slices.IndexFunc(m.userTOTP, func(u UserTotp) bool { return u.UserID == userID })
+}
+
+func (m *MemoryStore) ConfirmTOTP(ctx context.Context, arg ConfirmTOTPParams) (UserTotp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.totpIndex(arg.UserID)
+	if i < 0 || m.userTOTP[i].ConfirmedAt.Valid {
+		return UserTotp{}, sql.ErrNoRows
+	}
+	m.userTOTP[i].ConfirmedAt = sql.NullTime{Time: now(), Valid: true}
+	m.userTOTP[i].LastUsedStep = arg.LastUsedStep
+	return m.userTOTP[i], nil
+}
+
+func (m *MemoryStore) CreateTOTPRecoveryCode(ctx context.Context, arg CreateTOTPRecoveryCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return foreignKeyViolation("totp_recovery_codes", "fk_user_id")
+	}
+	m.totpRecoveryCodes = append(m.totpRecoveryCodes, TotpRecoveryCode{
+		ID: uuid.New(),
+		CodeHash: arg.CodeHash,
+		CreatedAt: now(),
+		UserID: arg.UserID,
+	})
+	return nil
+}
+
+func (m *MemoryStore) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userTOTP = slices.DeleteFunc(m.userTOTP, func(u UserTotp) bool { return u.UserID == userID })
+	return nil
+}
+
+func (m *MemoryStore) DeleteTOTPRecoveryCodesByUserID(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totpRecoveryCodes = slices.DeleteFunc(m.totpRecoveryCodes, func(c TotpRecoveryCode) bool { return c.UserID == userID })
+	return nil
+}
+
+func (m *MemoryStore) GetTOTPByUserID(ctx context.Context, userID uuid.UUID) (UserTotp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.totpIndex(userID)
+	if i < 0 {
+		return UserTotp{}, sql.ErrNoRows
+	}
+	return m.userTOTP[i], nil
+}
+
+func (m *MemoryStore) UpsertTOTPEnrollment(ctx context.Context, arg UpsertTOTPEnrollmentParams) (UserTotp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userIndex(arg.UserID) < 0 {
+		return UserTotp{}, foreignKeyViolation("user_totp", "fk_user_id")
+	}
+	enrollment := UserTotp{
+		UserID: arg.UserID,
+		CreatedAt: now(),
+		Secret: arg.Secret,
+	}
+	i := m.totpIndex(arg.UserID)
+	if i < 0 {
+		m.userTOTP = append(m.userTOTP, enrollment)
+		return enrollment, nil
+	}
+	// The conflicting row is left alone once it is confirmed, and
+	// RETURNING produces nothing.
+	if m.userTOTP[i].ConfirmedAt.Valid {
+		return UserTotp{}, sql.ErrNoRows
+	}
+	m.userTOTP[i] = enrollment
+	return enrollment, nil
+}
+
+func (m *MemoryStore) ListUnusedTOTPRecoveryCodesByUserID(ctx context.Context, userID uuid.UUID) ([]TotpRecoveryCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var codes []TotpRecoveryCode
+	for _, code := range m.totpRecoveryCodes {
+		if code.UserID == userID && !code.UsedAt.Valid {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func (m *MemoryStore) UseTOTPRecoveryCode(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.totpRecoveryCodes, func(c TotpRecoveryCode) bool {
+		return c.ID == id && !c.UsedAt.Valid
+	})
+	if i < 0 {
+		return 0, nil
+	}
+	m.totpRecoveryCodes[i].UsedAt = sql.NullTime{Time: now(), Valid: true}
+	return 1, nil
+}
+
+func (m *MemoryStore) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.totpIndex(arg.UserID)
+	if i < 0 || m.userTOTP[i].LastUsedStep >= arg.LastUsedStep {
+		return 0, nil
+	}
+	m.userTOTP[i].LastUsedStep = arg.LastUsedStep
+	return 1, nil
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+func (m *MemoryStore) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.emailTaken(arg.Email, uuid.Nil) {
+		return User{}, uniqueViolation("users_email_key")
+	}
+	t := now()
+	user := User{
+		ID: uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Email: arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role: "user",
+	}
+	m.users = append(m.users, user)
+	return user, nil
+}
+
+func (m *MemoryStore) GetUserFromEmail(ctx context.Context, email string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := slices.IndexFunc(m.users, func(u User) bool { return u.Email == email })
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) UpdateUserEmailPasswordByID(ctx context.Context, arg UpdateUserEmailPasswordByIDParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.userIndex(arg.ID)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	if m.emailTaken(arg.Email, arg.ID) {
+		return User{}, uniqueViolation("users_email_key")
+	}
+	if m.users[i].Email != arg.Email {
+		m.users[i].EmailVerifiedAt = sql.NullTime{}
+	}
+	m.users[i].Email = arg.Email
+	m.users[i].HashedPassword = arg.HashedPassword
+	m.users[i].UpdatedAt = now()
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) UpdateUserPasswordByID(ctx context.Context, arg UpdateUserPasswordByIDParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Like an UPDATE that matches nothing, a missing user is not an error.
+	if i := m.userIndex(arg.ID); i >= 0 {
+		m.users[i].HashedPassword = arg.HashedPassword
+		m.users[i].UpdatedAt = now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.userIndex(arg.ID)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	if !slices.Contains([]string{"user", "moderator", "admin"}, arg.Role) {
+		return User{}, checkViolation("users", "users_role_check")
+	}
+	m.users[i].Role = arg.Role
+	m.users[i].UpdatedAt = now()
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) UpgradeUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.userIndex(id)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	m.users[i].IsChirpyRed = true
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) DowngradeUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.userIndex(id)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	m.users[i].IsChirpyRed = false
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.userIndex(id)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.userIndex(arg.ID)
+	if i < 0 || m.users[i].Email != arg.Email {
+		return User{}, sql.ErrNoRows
+	}
+	t := now()
+	m.users[i].EmailVerifiedAt = sql.NullTime{Time: t, Valid: true}
+	m.users[i].UpdatedAt = t
+	return m.users[i], nil
+}
+
+func (m *MemoryStore) GetUserTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.userIndex(id)
+	if i < 0 {
+		return sql.NullTime{}, sql.ErrNoRows
+	}
+	return m.users[i].TokensValidAfter, nil
+}
+
+func (m *MemoryStore) RevokeUserTokens(ctx context.Context, arg RevokeUserTokensParams) (sql.NullTime, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.userIndex(arg.ID)
+	if i < 0 {
+		return sql.NullTime{}, sql.ErrNoRows
+	}
+	m.users[i].TokensValidAfter = sql.NullTime{Time: timestamp(arg.ValidAfter), Valid: true}
+	return m.users[i].TokensValidAfter, nil
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (m *MemoryStore) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.webhookEvents, func(e WebhookEvent) bool { return e.ID == arg.ID }) {
+		return 0, nil
+	}
+	m.webhookEvents = append(m.webhookEvents, WebhookEvent{ID: arg.ID, Event: arg.Event, ReceivedAt: arg.ReceivedAt})
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteWebhookEvent(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhookEvents = slices.DeleteFunc(m.webhookEvents, func(e WebhookEvent) bool { return e.ID == id })
+	return nil
+}
+
+func (m *MemoryStore) DeleteWebhookEventsReceivedBefore(ctx context.Context, receivedAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.webhookEvents)
+	m.webhookEvents = slices.DeleteFunc(m.webhookEvents, func(e WebhookEvent) bool { return e.ReceivedAt.Before(receivedAt) })
+	return int64(before - len(m.webhookEvents)), nil
+}
@@ -11,28 +11,158 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	KeyHash    string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
 	CreatedAt time.Time
-	UpdatedAt time.Time
 	UserID    uuid.UUID
+	Email     string
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
 }
 
-type User struct {
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginLockoutEvent struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
+	ThrottleKey    string
+	UserID         uuid.NullUUID
+	Event          string
+	FailedAttempts int32
+	LockedUntil    sql.NullTime
+}
+
+type LoginThrottle struct {
+	Key            string
+	UserID         uuid.NullUUID
+	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	FailedAttempts int32
+	Lockouts       int32
+	LockedUntil    sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	UserID    uuid.UUID
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Subscription struct {
+	UserID             uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+}
+
+type SubscriptionEvent struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Event       string
+	PeriodStart sql.NullTime
+	PeriodEnd   sql.NullTime
+}
+
+type TotpRecoveryCode struct {
+	ID        uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	EmailVerifiedAt  sql.NullTime
+	Role             string
+	TokensValidAfter sql.NullTime
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	CreatedAt    time.Time
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+}
+
+type WebhookEvent struct {
+	ID         string
+	Event      string
+	ReceivedAt time.Time
 }
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Store is everything the handlers need from persistence. It is satisfied by
+// the sqlc generated *Queries (backed by Postgres) and by *MemoryStore.
+type Store interface {
+	Querier
+}
+
+var _ Store = (*Queries)(nil)
+var _ Store = (*MemoryStore)(nil)
+
+// Postgres error codes that callers may want to tell apart from other failures.
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeCheckViolation      = "23514"
+)
+
+// IsUniqueViolation reports whether err is a unique constraint violation,
+// regardless of which Store implementation produced it.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == codeUniqueViolation
+}
+
+// IsForeignKeyViolation reports whether err is a foreign key violation.
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == codeForeignKeyViolation
+}
+
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Code: codeUniqueViolation,
+		Message: fmt.Sprintf("duplicate key value violates unique constraint \"%s\"", constraint),
+		Constraint: constraint,
+	}
+}
+
+func foreignKeyViolation(table, constraint string) error {
+	return &pq.Error{
+		Code: codeForeignKeyViolation,
+		Message: fmt.Sprintf("insert or update on table \"%s\" violates foreign key constraint \"%s\"", table, constraint),
+		Table: table,
+		Constraint: constraint,
+	}
+}
+
+func checkViolation(table, constraint string) error {
+	return &pq.Error{
+		Code: codeCheckViolation,
+		Message: fmt.Sprintf("new row for relation \"%s\" violates check constraint \"%s\"", table, constraint),
+		Table: table,
+		Constraint: constraint,
+	}
+}
@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -14,7 +16,7 @@ import (
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after
 `
 
 type CreateUserParams struct {
@@ -32,6 +34,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
@@ -45,8 +50,54 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const downgradeUserByID = `-- name: DowngradeUserByID :one
+UPDATE users
+SET is_chirpy_red = false
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after
+`
+
+func (q *Queries) DowngradeUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, downgradeUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
 const getUserFromEmail = `-- name: GetUserFromEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after FROM users
 WHERE email = $1
 `
 
@@ -60,15 +111,54 @@ func (q *Queries) GetUserFromEmail(ctx context.Context, email string) (User, err
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
 
+const getUserTokensValidAfter = `-- name: GetUserTokensValidAfter :one
+SELECT tokens_valid_after FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokensValidAfter, id)
+	var tokens_valid_after sql.NullTime
+	err := row.Scan(&tokens_valid_after)
+	return tokens_valid_after, err
+}
+
+const revokeUserTokens = `-- name: RevokeUserTokens :one
+UPDATE users
+SET tokens_valid_after = $1::timestamp
+WHERE id = $2
+RETURNING tokens_valid_after
+`
+
+type RevokeUserTokensParams struct {
+	ValidAfter time.Time
+	ID         uuid.UUID
+}
+
+// Access tokens issued before tokens_valid_after are rejected. The column has
+// no time zone, so valid_after is passed in UTC rather than taken from NOW().
+func (q *Queries) RevokeUserTokens(ctx context.Context, arg RevokeUserTokensParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, revokeUserTokens, arg.ValidAfter, arg.ID)
+	var tokens_valid_after sql.NullTime
+	err := row.Scan(&tokens_valid_after)
+	return tokens_valid_after, err
+}
+
 const updateUserEmailPasswordByID = `-- name: UpdateUserEmailPasswordByID :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
+SET email = $1,
+    hashed_password = $2,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after
 `
 
 type UpdateUserEmailPasswordByIDParams struct {
@@ -77,6 +167,7 @@ type UpdateUserEmailPasswordByIDParams struct {
 	ID             uuid.UUID
 }
 
+// A new email address has to be verified again.
 func (q *Queries) UpdateUserEmailPasswordByID(ctx context.Context, arg UpdateUserEmailPasswordByIDParams) (User, error) {
 	row := q.db.QueryRowContext(ctx, updateUserEmailPasswordByID, arg.Email, arg.HashedPassword, arg.ID)
 	var i User
@@ -87,6 +178,54 @@ func (q *Queries) UpdateUserEmailPasswordByID(ctx context.Context, arg UpdateUse
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const updateUserPasswordByID = `-- name: UpdateUserPasswordByID :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordByIDParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPasswordByID(ctx context.Context, arg UpdateUserPasswordByIDParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPasswordByID, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
@@ -95,7 +234,7 @@ const upgradeUserByID = `-- name: UpgradeUserByID :one
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after
 `
 
 func (q *Queries) UpgradeUserByID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -108,6 +247,38 @@ func (q *Queries) UpgradeUserByID(ctx context.Context, id uuid.UUID) (User, erro
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, role, tokens_valid_after
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
@@ -0,0 +1,84 @@
+// Package mailer sends the emails the server needs, such as password resets.
+// The implementations here are meant for development; anything that can
+// deliver a Message can be plugged in through the Mailer interface.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Message struct {
+	From string
+	To string
+	Subject string
+	Body string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Line breaks in a header value would let it add headers of its own.
+var headerEscaper = strings.NewReplacer("\r", " ", "\n", " ")
+
+// WriteTo renders msg as a minimal RFC 5322 message.
+func (msg Message) WriteTo(w io.Writer) (int64, error) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "From: %s\r\n", headerEscaper.Replace(msg.From))
+	fmt.Fprintf(&out, "To: %s\r\n", headerEscaper.Replace(msg.To))
+	fmt.Fprintf(&out, "Subject: %s\r\n", headerEscaper.Replace(msg.Subject))
+	out.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	out.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+// LogMailer logs every message instead of delivering it.
+type LogMailer struct {
+	logger *slog.Logger
+}
+
+func NewLogMailer(logger *slog.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.InfoContext(ctx, "sending email", "from", msg.From, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in a directory, which
+// most mail clients can open.
+type FileMailer struct {
+	dir string
+	sent atomic.Int64
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	// The counter keeps names unique when two messages share a timestamp.
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405.000000000"), m.sent.Add(1))
+	file, err := os.OpenFile(filepath.Join(m.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatalf("could not create mailer: %v", err)
+	}
+
+	msg := Message{From: "chirpy@example.com", To: "walt@example.com", Subject: "Hello", Body: "line one\nline two"}
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("could not send message: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 messages, got %v (%v)", files, err)
+	}
+	contents, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("could not read message: %v", err)
+	}
+	expected := "From: chirpy@example.com\r\nTo: walt@example.com\r\nSubject: Hello\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nline one\r\nline two"
+	if string(contents) != expected {
+		t.Errorf("unexpected message contents:\n%q\nexpected:\n%q", contents, expected)
+	}
+}
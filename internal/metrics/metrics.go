@@ -0,0 +1,344 @@
+// Package metrics is a small, dependency free registry of counters, gauges
+// and histograms that renders the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets suit request latencies measured in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu sync.Mutex
+	collectors []collector
+	names map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]struct{}{}}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.names[name]; ok {
+		panic("metrics: duplicate metric name " + name)
+	}
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText renders every metric in registration order.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// atomicFloat is a float64 that can be updated without a lock.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+type Counter struct {
+	value atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add panics on negative values, which a counter cannot go down by.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.value.Add(delta)
+}
+
+func (c *Counter) Value() float64 {
+	return c.value.Load()
+}
+
+// Reset sets the counter back to zero. Scrapers treat this as a restart.
+func (c *Counter) Reset() {
+	c.value.Set(0)
+}
+
+type Gauge struct {
+	value atomicFloat
+}
+
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+func (g *Gauge) Set(value float64) {
+	g.value.Set(value)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.value.Load()
+}
+
+type Histogram struct {
+	mu sync.Mutex
+	upperBounds []float64
+	bucketCounts []uint64
+	count uint64
+	sum float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upperBounds: buckets, bucketCounts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upperBound := range h.upperBounds {
+		if value <= upperBound {
+			h.bucketCounts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// metricFamily holds one child per distinct set of label values.
+type metricFamily[T any] struct {
+	name string
+	help string
+	kind string
+	labelNames []string
+	newChild func() T
+	mu sync.RWMutex
+	children map[string]*labeledChild[T]
+}
+
+type labeledChild[T any] struct {
+	labelValues []string
+	child T
+}
+
+func (f *metricFamily[T]) with(labelValues ...string) T {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	existing, ok := f.children[key]
+	f.mu.RUnlock()
+	if ok {
+		return existing.child
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.children[key]; ok {
+		return existing.child
+	}
+	created := &labeledChild[T]{labelValues: append([]string(nil), labelValues...), child: f.newChild()}
+	f.children[key] = created
+	return created.child
+}
+
+// sortedChildren orders output by label values so scrapes are stable.
+func (f *metricFamily[T]) sortedChildren() []*labeledChild[T] {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	children := make([]*labeledChild[T], 0, len(f.children))
+	for _, child := range f.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].labelValues, "\xff") < strings.Join(children[j].labelValues, "\xff")
+	})
+	return children
+}
+
+func (f *metricFamily[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+func newFamily[T any](name, help, kind string, labelNames []string, newChild func() T) *metricFamily[T] {
+	return &metricFamily[T]{
+		name: name,
+		help: help,
+		kind: kind,
+		labelNames: labelNames,
+		newChild: newChild,
+		children: map[string]*labeledChild[T]{},
+	}
+}
+
+type CounterVec struct {
+	family *metricFamily[*Counter]
+}
+
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.family.with(labelValues...)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.family.writeHeader(w)
+	for _, c := range v.family.sortedChildren() {
+		writeSample(w, v.family.name, v.family.labelNames, c.labelValues, c.child.Value())
+	}
+}
+
+type GaugeVec struct {
+	family *metricFamily[*Gauge]
+}
+
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return v.family.with(labelValues...)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.family.writeHeader(w)
+	for _, c := range v.family.sortedChildren() {
+		writeSample(w, v.family.name, v.family.labelNames, c.labelValues, c.child.Value())
+	}
+}
+
+type HistogramVec struct {
+	family *metricFamily[*Histogram]
+}
+
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	return v.family.with(labelValues...)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.family.writeHeader(w)
+	bucketLabels := append(append([]string(nil), v.family.labelNames...), "le")
+	for _, c := range v.family.sortedChildren() {
+		h := c.child
+		h.mu.Lock()
+		for i, upperBound := range h.upperBounds {
+			values := append(append([]string(nil), c.labelValues...), formatFloat(upperBound))
+			writeSample(w, v.family.name+"_bucket", bucketLabels, values, float64(h.bucketCounts[i]))
+		}
+		values := append(append([]string(nil), c.labelValues...), "+Inf")
+		writeSample(w, v.family.name+"_bucket", bucketLabels, values, float64(h.count))
+		writeSample(w, v.family.name+"_sum", v.family.labelNames, c.labelValues, h.sum)
+		writeSample(w, v.family.name+"_count", v.family.labelNames, c.labelValues, float64(h.count))
+		h.mu.Unlock()
+	}
+}
+
+// NewCounter registers a counter without labels.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{family: newFamily(name, help, "counter", labelNames, func() *Counter { return &Counter{} })}
+	r.register(name, v)
+	return v
+}
+
+// NewGauge registers a gauge without labels.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	v := &GaugeVec{family: newFamily(name, help, "gauge", labelNames, func() *Gauge { return &Gauge{} })}
+	r.register(name, v)
+	return v
+}
+
+// NewHistogramVec registers a histogram. buckets must be sorted ascending.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram buckets must be sorted")
+	}
+	v := &HistogramVec{family: newFamily(name, help, "histogram", labelNames, func() *Histogram { return newHistogram(buckets) })}
+	r.register(name, v)
+	return v
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteString("{")
+		for i, labelName := range labelNames {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labelName, escapeLabelValue(labelValues[i]))
+		}
+		w.WriteString("}")
+	}
+	w.WriteString(" ")
+	w.WriteString(formatFloat(value))
+	w.WriteString("\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
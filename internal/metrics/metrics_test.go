@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	registry := NewRegistry()
+	hits := registry.NewCounter("hits_total", "Number of hits.")
+	requests := registry.NewCounterVec("requests_total", "Requests by route.", "route", "status")
+	inFlight := registry.NewGauge("in_flight", "Requests being served.")
+	latency := registry.NewHistogramVec("latency_seconds", "Latency with a \\ and a\nnewline.", []float64{0.1, 1}, "route")
+
+	hits.Inc()
+	hits.Add(2)
+	requests.With("/b", "200").Inc()
+	requests.With("/a", "500").Inc()
+	requests.With(`say "hi"`, "200").Inc()
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.With("/a").Observe(0.05)
+	latency.With("/a").Observe(0.5)
+	latency.With("/a").Observe(3)
+
+	var out strings.Builder
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatalf("could not write metrics: %v", err)
+	}
+
+	expected := `# HELP hits_total Number of hits.
+# TYPE hits_total counter
+hits_total 3
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 1
+requests_total{route="/b",status="200"} 1
+requests_total{route="say \"hi\"",status="200"} 1
+# HELP in_flight Requests being served.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency with a \\ and a\nnewline.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.55
+latency_seconds_count{route="/a"} 3
+`
+	if out.String() != expected {
+		t.Errorf("unexpected exposition output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestCounterReset(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("resets_total", "Counter that gets reset.")
+
+	cases := []struct{
+		add float64
+		reset bool
+		expected float64
+	}{
+		{add: 5, reset: false, expected: 5},
+		{add: 1, reset: true, expected: 0},
+		{add: 2, reset: false, expected: 2},
+	}
+
+	for _, c := range cases {
+		counter.Add(c.add)
+		if c.reset {
+			counter.Reset()
+		}
+		if counter.Value() != c.expected {
+			t.Errorf("expected counter to be %v, got %v", c.expected, counter.Value())
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Package migrate applies the goose annotated schema files in sql/schema.
+//
+// Applied versions are recorded in goose's own goose_db_version table, so a
+// database that was migrated with the goose CLI can be taken over by this
+// runner (and the other way around) without replaying anything.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoMigrationsToRollBack = errors.New("no migrations to roll back")
+
+const versionTable = "goose_db_version"
+
+// lockID is an arbitrary key for pg_advisory_lock so that several instances
+// starting at once do not apply the same migration twice.
+const lockID = 7240617346
+
+type Migration struct {
+	Version int64
+	Name string
+	Up string
+	Down string
+	// NoTransaction is set by "-- +goose NO TRANSACTION" for statements such
+	// as CREATE INDEX CONCURRENTLY that cannot run inside a transaction.
+	NoTransaction bool
+}
+
+type Status struct {
+	Migration Migration
+	Applied bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db *sql.DB
+	migrations []Migration
+}
+
+// New loads every *.sql file at the root of fsys. File names must start with
+// the version number, as in 001_users.sql.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	seen := map[int64]string{}
+	for _, name := range names {
+		versionString, _, _ := strings.Cut(path.Base(name), "_")
+		version, err := strconv.ParseInt(versionString, 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: file name must start with a positive version number", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migration %s: version %d is also used by %s", name, version, other)
+		}
+		seen[version] = name
+
+		contents, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := Parse(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", name, err)
+		}
+		migration.Version = version
+		migration.Name = name
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Parse splits a goose annotated file into its Up and Down sections.
+func Parse(contents string) (Migration, error) {
+	var migration Migration
+	var up, down strings.Builder
+	var current *strings.Builder
+	foundUp := false
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		annotation, isAnnotation := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+		if !isAnnotation {
+			if current != nil {
+				current.WriteString(line)
+				current.WriteString("\n")
+			}
+			continue
+		}
+		switch strings.TrimSpace(annotation) {
+		case "Up":
+			current = &up
+			foundUp = true
+		case "Down":
+			current = &down
+		case "NO TRANSACTION":
+			migration.NoTransaction = true
+		case "StatementBegin", "StatementEnd":
+			// Each section is sent as a single simple query, so statement
+			// boundaries do not need to be tracked.
+		default:
+			return Migration{}, fmt.Errorf("unknown annotation %q", annotation)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Migration{}, err
+	}
+	if !foundUp {
+		return Migration{}, errors.New("missing -- +goose Up annotation")
+	}
+
+	migration.Up = strings.TrimSpace(up.String())
+	migration.Down = strings.TrimSpace(down.String())
+	return migration, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Latest is the version the database is at once every migration is applied.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration in version order and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	ran := []Migration{}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := run(ctx, conn, migration, migration.Up, true); err != nil {
+			return ran, err
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	defer unlock()
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		return migration, run(ctx, conn, migration, migration.Down, false)
+	}
+	return Migration{}, ErrNoMigrationsToRollBack
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// Version is the highest applied version, or 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version sql.NullInt64
+	err := m.db.QueryRowContext(ctx, "SELECT MAX(version_id) FROM "+versionTable+" WHERE is_applied").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version.Int64, nil
+}
+
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, func(), error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("could not acquire migration lock: %w", err)
+	}
+	unlock := func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+		conn.Close()
+	}
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return conn, unlock, nil
+}
+
+func ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (
+    id SERIAL PRIMARY KEY,
+    version_id BIGINT NOT NULL,
+    is_applied BOOLEAN NOT NULL,
+    tstamp TIMESTAMP DEFAULT NOW()
+)`)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", versionTable, err)
+	}
+	// goose seeds the table with version 0; keep doing so for compatibility.
+	_, err = conn.ExecContext(ctx, `INSERT INTO `+versionTable+` (version_id, is_applied)
+SELECT 0, true WHERE NOT EXISTS (SELECT 1 FROM `+versionTable+`)`)
+	return err
+}
+
+// appliedVersions follows goose: the newest row for a version decides whether it is applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version_id, is_applied, tstamp FROM "+versionTable+" ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[int64]struct{}{}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[version]; ok {
+			continue
+		}
+		seen[version] = struct{}{}
+		if isApplied && version > 0 {
+			applied[version] = tstamp.Time
+		}
+	}
+	return applied, rows.Err()
+}
+
+func run(ctx context.Context, conn *sql.Conn, migration Migration, statements string, up bool) error {
+	record := func(exec func(context.Context, string, ...interface{}) (sql.Result, error)) error {
+		var err error
+		if up {
+			_, err = exec(ctx, "INSERT INTO "+versionTable+" (version_id, is_applied) VALUES ($1, true)", migration.Version)
+		} else {
+			_, err = exec(ctx, "DELETE FROM "+versionTable+" WHERE version_id = $1", migration.Version)
+		}
+		return err
+	}
+
+	if migration.NoTransaction {
+		if statements != "" {
+			if _, err := conn.ExecContext(ctx, statements); err != nil {
+				return fmt.Errorf("migration %s: %w", migration.Name, err)
+			}
+		}
+		return record(conn.ExecContext)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if statements != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			return fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+	}
+	if err := record(tx.ExecContext); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct{
+		input string
+		expected Migration
+		expectError bool
+	}{
+		{
+			input: "-- +goose Up\nCREATE TABLE a (id INT);\n\n-- +goose Down\nDROP TABLE a;",
+			expected: Migration{Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"},
+		},
+		{
+			input: "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n-- +goose StatementEnd\n",
+			expected: Migration{Up: "SELECT 1;"},
+		},
+		{
+			input: "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON a (id);\n-- +goose Down\nDROP INDEX i;",
+			expected: Migration{Up: "CREATE INDEX CONCURRENTLY i ON a (id);", Down: "DROP INDEX i;", NoTransaction: true},
+		},
+		{
+			input: "CREATE TABLE a (id INT);",
+			expectError: true,
+		},
+		{
+			input: "-- +goose Up\n-- +goose Sideways\n",
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		actual, err := Parse(c.input)
+		if (err != nil) != c.expectError {
+			t.Errorf("Test failed for input %q, unexpected error: %v", c.input, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("Test failed for input %q, expected %+v but got %+v", c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_chirps.sql": {Data: []byte("-- +goose Up\nCREATE TABLE chirps (id INT);\n-- +goose Down\nDROP TABLE chirps;")},
+		"001_users.sql": {Data: []byte("-- +goose Up\nCREATE TABLE users (id INT);\n-- +goose Down\nDROP TABLE users;")},
+		"README.md": {Data: []byte("not a migration")},
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("could not load migrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Errorf("expected versions 1 and 2 in order, got: %+v", migrations)
+	}
+
+	invalid := []fstest.MapFS{
+		{"users.sql": {Data: []byte("-- +goose Up\nSELECT 1;")}},
+		{
+			"001_users.sql": {Data: []byte("-- +goose Up\nSELECT 1;")},
+			"1_again.sql": {Data: []byte("-- +goose Up\nSELECT 1;")},
+		},
+	}
+	for _, fsys := range invalid {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("expected an error loading %v", fsys)
+		}
+	}
+}
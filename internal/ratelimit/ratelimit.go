@@ -0,0 +1,163 @@
+// Package ratelimit implements in-memory token buckets keyed by arbitrary
+// strings such as a user ID or client IP.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit allows Requests requests per Per. A bucket holds at most Requests
+// tokens and refills continuously, so short bursts up to Requests are fine.
+type Limit struct {
+	Requests int
+	Per time.Duration
+}
+
+func (l Limit) IsZero() bool {
+	return l.Requests == 0 || l.Per == 0
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// Scale multiplies the number of requests, keeping the period.
+func (l Limit) Scale(factor int) Limit {
+	return Limit{Requests: l.Requests * factor, Per: l.Per}
+}
+
+func (l Limit) refillInterval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+// ParseLimit parses "requests/period", e.g. "5/1m" or "100/1h".
+func ParseLimit(value string) (Limit, error) {
+	requests, per, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w: %q, expected requests/period", ErrInvalidLimit, value)
+	}
+	count, err := strconv.Atoi(requests)
+	if err != nil || count < 1 {
+		return Limit{}, fmt.Errorf("%w: %q is not a positive request count", ErrInvalidLimit, requests)
+	}
+	period, err := time.ParseDuration(per)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q is not a positive duration", ErrInvalidLimit, per)
+	}
+	return Limit{Requests: count, Per: period}, nil
+}
+
+// ParseRules parses a comma separated list of "route=requests/period" pairs,
+// e.g. "POST /api/login=5/1m,POST /api/chirps=30/1m".
+func ParseRules(value string) (map[string]Limit, error) {
+	rules := map[string]Limit{}
+	for _, rule := range strings.Split(value, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q, expected route=requests/period", ErrInvalidLimit, rule)
+		}
+		parsed, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		rules[strings.TrimSpace(route)] = parsed
+	}
+	return rules, nil
+}
+
+// Result describes the state of a bucket after a call to Allow.
+type Result struct {
+	Allowed bool
+	Limit int
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	updated time.Time
+	limit Limit
+}
+
+// refill tops the bucket up for the time passed since it was last updated.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Requests), b.tokens+elapsed.Seconds()/b.limit.refillInterval().Seconds())
+		b.updated = now
+	}
+}
+
+func (b *bucket) full() bool {
+	return b.tokens >= float64(b.limit.Requests)
+}
+
+// Limiter holds one bucket per key. Buckets that have refilled completely
+// are forgotten, so memory grows with active clients rather than all clients.
+type Limiter struct {
+	mu sync.Mutex
+	buckets map[string]*bucket
+	now func() time.Time
+	lastPrune time.Time
+}
+
+const pruneInterval = time.Minute
+
+func New() *Limiter {
+	return &Limiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Allow takes a token from the bucket for key if one is available. A key
+// seen with a different limit than before starts a fresh bucket.
+func (l *Limiter) Allow(key string, limit Limit) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastPrune) > pruneInterval {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Requests), updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	interval := limit.refillInterval().Seconds()
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * interval * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(limit.Requests) - b.tokens) * interval * float64(time.Second))
+	return result
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.full() {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
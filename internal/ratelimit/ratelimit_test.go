@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Per: time.Minute}
+
+	cases := []struct{
+		name string
+		key string
+		advance time.Duration
+		expectedAllowed bool
+		expectedRemaining int
+		expectedRetryAfter time.Duration
+	}{
+		{name: "first request", key: "a", expectedAllowed: true, expectedRemaining: 1},
+		{name: "second request", key: "a", expectedAllowed: true, expectedRemaining: 0},
+		{name: "bucket empty", key: "a", expectedAllowed: false, expectedRemaining: 0, expectedRetryAfter: 30 * time.Second},
+		{name: "other key has its own bucket", key: "b", expectedAllowed: true, expectedRemaining: 1},
+		{name: "partly refilled", key: "a", advance: 10 * time.Second, expectedAllowed: false, expectedRemaining: 0, expectedRetryAfter: 20 * time.Second},
+		{name: "one token refilled", key: "a", advance: 20 * time.Second, expectedAllowed: true, expectedRemaining: 0},
+		{name: "fully refilled", key: "a", advance: 5 * time.Minute, expectedAllowed: true, expectedRemaining: 1},
+	}
+
+	for _, c := range cases {
+		now = now.Add(c.advance)
+		result := limiter.Allow(c.key, limit)
+		if result.Allowed != c.expectedAllowed || result.Remaining != c.expectedRemaining || result.RetryAfter != c.expectedRetryAfter {
+			t.Errorf("Test failed for %s, got %+v", c.name, result)
+		}
+	}
+}
+
+func TestPruneForgetsFullBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 10, Per: time.Minute}
+
+	limiter.Allow("idle", limit)
+	now = now.Add(2 * pruneInterval)
+	limiter.Allow("active", limit)
+
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Errorf("expected the refilled bucket to be pruned")
+	}
+	if _, ok := limiter.buckets["active"]; !ok {
+		t.Errorf("expected the active bucket to be kept")
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	cases := []struct{
+		input string
+		expected map[string]Limit
+		expectedError error
+	}{
+		{
+			input: "POST /api/login=5/1m, POST /api/chirps=30/1m",
+			expected: map[string]Limit{
+				"POST /api/login": {Requests: 5, Per: time.Minute},
+				"POST /api/chirps": {Requests: 30, Per: time.Minute},
+			},
+		},
+		{input: "", expected: map[string]Limit{}},
+		{input: "POST /api/login", expectedError: ErrInvalidLimit},
+		{input: "POST /api/login=five/1m", expectedError: ErrInvalidLimit},
+		{input: "POST /api/login=5/0s", expectedError: ErrInvalidLimit},
+	}
+
+	for _, c := range cases {
+		rules, err := ParseRules(c.input)
+		if !errors.Is(err, c.expectedError) {
+			t.Errorf("Test failed for %q, expected error %v but got %v", c.input, c.expectedError, err)
+			continue
+		}
+		if len(rules) != len(c.expected) {
+			t.Errorf("Test failed for %q, expected %v but got %v", c.input, c.expected, rules)
+		}
+		for route, limit := range c.expected {
+			if rules[route] != limit {
+				t.Errorf("Test failed for %q, expected %s for %s but got %s", c.input, limit, route, rules[route])
+			}
+		}
+	}
+}
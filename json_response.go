@@ -2,16 +2,15 @@ package main
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 )
 
 func respondWithError(resWriter http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
+	logger := requestLogger(resWriter)
 	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+		logger.Error("responding with 5XX error", "status", code, "message", msg, "error", err)
+	} else if err != nil {
+		logger.Info("responding with error", "status", code, "message", msg, "error", err)
 	}
 	type errorResponse struct {
 		Error string `json:"error"`
@@ -25,10 +24,10 @@ func respondWithJSON(resWriter http.ResponseWriter, code int, payload interface{
 	resWriter.WriteHeader(code)
 	res, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshaling JSON: %s", err)
+		requestLogger(resWriter).Error("error marshaling JSON", "error", err)
 		res = []byte("An unexpected error occurred")
 		resWriter.Header().Set("Content-Type", "text/plaintext")
 		resWriter.WriteHeader(500)
 	}
 	resWriter.Write(res)
-}
\ No newline at end of file
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrAccountLocked = errors.New("account is locked after repeated failed logins")
+var ErrClientLocked = errors.New("client is locked after repeated failed logins")
+
+const (
+	lockoutEventLocked = "locked"
+	lockoutEventUnlocked = "unlocked"
+)
+
+// dummyPasswordHash is compared against when there is no real hash to check,
+// so a login takes as long whether or not the account exists.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("not a real password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func accountThrottleKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (cfg *apiConfig) loginLocked(ctx context.Context, key string) (bool, error) {
+	throttle, err := cfg.db.GetLoginThrottle(ctx, key)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(time.Now()), nil
+}
+
+// lockoutDuration doubles the base lockout for every earlier lockout of the
+// same key, up to the configured maximum.
+func (cfg *apiConfig) lockoutDuration(previousLockouts int32) time.Duration {
+	duration := cfg.config.LoginLockoutBase
+	for i := int32(0); i < previousLockouts && duration < cfg.config.LoginLockoutMax; i++ {
+		duration *= 2
+	}
+	return min(duration, cfg.config.LoginLockoutMax)
+}
+
+// recordLoginFailure counts a failed login against key and locks it once
+// maxFailures is reached.
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, key string, userID uuid.NullUUID, maxFailures int) error {
+	now := time.Now().UTC()
+	throttle, err := cfg.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key: key,
+		UserID: userID,
+		Now: now,
+		StaleBefore: now.Add(-cfg.config.LoginFailureWindow),
+	})
+	if err != nil {
+		return err
+	}
+	if int(throttle.FailedAttempts) < maxFailures {
+		return nil
+	}
+
+	lockedUntil := sql.NullTime{Time: now.Add(cfg.lockoutDuration(throttle.Lockouts)), Valid: true}
+	if _, err := cfg.db.LockLoginThrottle(ctx, database.LockLoginThrottleParams{Key: key, LockedUntil: lockedUntil, UpdatedAt: now}); err != nil {
+		return err
+	}
+	err = cfg.db.CreateLoginLockoutEvent(ctx, database.CreateLoginLockoutEventParams{
+		ThrottleKey: key,
+		UserID: userID,
+		Event: lockoutEventLocked,
+		FailedAttempts: throttle.FailedAttempts,
+		LockedUntil: lockedUntil,
+	})
+	if err != nil {
+		return err
+	}
+
+	kind := "ip"
+	if userID.Valid {
+		kind = "account"
+	}
+	cfg.metrics.loginLockouts.With(kind).Inc()
+	loggerFromContext(ctx).Warn("locked login after repeated failures", "key", key, "failed_attempts", throttle.FailedAttempts, "locked_until", lockedUntil.Time)
+	return nil
+}
@@ -1,68 +1,257 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/config"
 	"github.com/ansht2000/atServer/internal/database"
+	"github.com/ansht2000/atServer/internal/mailer"
+	"github.com/ansht2000/atServer/internal/ratelimit"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db *database.Queries
-	secretKey string
-	apiKey string
+	metrics *apiMetrics
+	db database.Store
+	config config.Config
+	logger *slog.Logger
+	// readinessChecks are run by /api/readyz on top of the draining check.
+	readinessChecks []readinessCheck
+	// rateLimits maps route patterns to the limit applied to each client.
+	rateLimits map[string]ratelimit.Limit
+	mailer mailer.Mailer
+	keyring *auth.Keyring
+	revocations *auth.RevocationCache
+	// draining is set once shutdown starts so readiness checks fail while
+	// in-flight requests finish.
+	draining atomic.Bool
 }
 
 func main() {
-	const filepathRoot = "."
-	const port = "8080"
-
 	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	conf, args, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger, err := newLogger(os.Stderr, conf.LogFormat, conf.LogLevel)
 	if err != nil {
-		log.Fatalf("could not establish connection to db: %v\n", err)
+		log.Fatal(err)
+	}
+	// Anything still using the log package goes through the same handler.
+	slog.SetDefault(logger)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "config":
+			fmt.Print(conf)
+			return
+		case "migrate":
+			if err := conf.ValidateDBURL(); err != nil {
+				log.Fatal(err)
+			}
+			db, err := sql.Open("postgres", conf.DBURL.Value())
+			if err != nil {
+				log.Fatalf("could not establish connection to db: %v\n", err)
+			}
+			defer db.Close()
+			if err := runMigrateCommand(context.Background(), db, args[1:], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q, expected config or migrate", args[0])
+		}
+	}
+	if err := conf.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	logger.Debug("loaded configuration", "config", conf)
+
+	var db *sql.DB
+	var store database.Store
+	var readinessChecks []readinessCheck
+	if conf.DBURL == "" {
+		// Validate only allows this on the dev platform. Everything is kept
+		// in memory and lost when the server stops.
+		log.Println("DB_URL is not set, using in-memory store")
+		store = database.NewMemoryStore()
+	} else {
+		db, err = sql.Open("postgres", conf.DBURL.Value())
+		if err != nil {
+			log.Fatalf("could not establish connection to db: %v\n", err)
+		}
+		configureDBPool(db, conf)
+		// Applying migrations at startup is opt-in; otherwise run "atServer migrate up".
+		if conf.MigrateOnStart {
+			if err := migrateUp(context.Background(), db); err != nil {
+				log.Fatalf("could not apply migrations: %v\n", err)
+			}
+		}
+		store = database.New(db)
+		readinessChecks, err = databaseReadinessChecks(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var mail mailer.Mailer = mailer.NewLogMailer(logger)
+	if conf.Mailer == config.MailerFile {
+		mail, err = mailer.NewFileMailer(conf.MailDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	keyring, err := loadKeyring(conf)
+	if err != nil {
+		log.Fatalf("could not load signing keys: %v\n", err)
+	}
+	logger.Info("loaded signing keys", "keys", keyring.KeyIDs(), "signing", keyring.SigningKeyID())
+
+	// Validate has already checked that the rules parse.
+	rateLimits, _ := ratelimit.ParseRules(conf.RateLimits)
+	apiCfg := &apiConfig{
+		metrics: newAPIMetrics(),
+		db: store,
+		config: conf,
+		logger: logger,
+		readinessChecks: readinessChecks,
+		rateLimits: rateLimits,
+		mailer: mail,
+		keyring: keyring,
+		revocations: newRevocationCache(store, conf.RevocationCacheTTL),
 	}
-	dbQueries := database.New(db)
-	secretKey := os.Getenv("SECRET")
-	apiKey := os.Getenv("POLKA_KEY")
-
-	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db: dbQueries,
-		secretKey: secretKey,
-		apiKey: apiKey,
+
+	server := newHTTPServer(conf, apiCfg.routes(conf.FilepathRoot))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go apiCfg.runSubscriptionSweeper(ctx, conf.SubscriptionSweepInterval)
+	go apiCfg.runRevocationSweeper(ctx, conf.RevocationSweepInterval)
+	// Without signing, event ids are the only guard against replays, so they
+	// are kept.
+	if conf.PolkaWebhookSecret != "" {
+		go apiCfg.runWebhookEventSweeper(ctx, conf.WebhookEventSweepInterval)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Serving files from %s on port: %d\n", conf.FilepathRoot, conf.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// A second signal skips the drain and exits straight away.
+	stop()
+
+	log.Println("Shutting down, draining in-flight requests")
+	apiCfg.draining.Store(true)
+	// Keep serving while load balancers notice that readiness is failing.
+	time.Sleep(conf.ShutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("could not drain all connections: %v\n", err)
 	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			log.Printf("could not close db: %v\n", err)
+		}
+	}
+	log.Println("Server stopped")
+}
+
+func newHTTPServer(conf config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr: ":" + strconv.Itoa(conf.Port),
+		Handler: handler,
+		ReadHeaderTimeout: conf.HTTPReadTimeout,
+		ReadTimeout: conf.HTTPReadTimeout,
+		WriteTimeout: conf.HTTPWriteTimeout,
+		IdleTimeout: conf.HTTPIdleTimeout,
+	}
+}
+
+func configureDBPool(db *sql.DB, conf config.Config) {
+	db.SetMaxOpenConns(conf.DBMaxOpenConns)
+	db.SetMaxIdleConns(conf.DBMaxIdleConns)
+	db.SetConnMaxLifetime(conf.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.DBConnMaxIdleTime)
+}
 
+func (cfg *apiConfig) routes(filepathRoot string) http.Handler {
 	serveMux := http.NewServeMux()
-	fileserverHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
+	fileserverHandler := cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
 	serveMux.Handle("/app/", fileserverHandler)
 
-	serveMux.HandleFunc("GET /api/healthz", handlerReadiness)
-	serveMux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
-	serveMux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
-	serveMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirpsFromID)
+	serveMux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+	serveMux.HandleFunc("GET /api/healthz", handlerLiveness)
+	serveMux.HandleFunc("GET /api/readyz", cfg.handlerReadiness)
+	serveMux.HandleFunc("GET /admin/metrics", cfg.requireRole(auth.RoleAdmin, cfg.handlerMetrics))
+	serveMux.HandleFunc("GET /admin/metrics/prometheus", cfg.requireRole(auth.RoleAdmin, cfg.handlerPrometheusMetrics))
+	serveMux.HandleFunc("GET /api/chirps", cfg.handlerGetChirps)
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetChirpsFromID)
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.handlerGetChirpThread)
+	serveMux.HandleFunc("GET /api/users/{userID}/likes", cfg.handlerGetUserLikes)
+	serveMux.HandleFunc("GET /api/users/{userID}/followers", cfg.handlerGetFollowers)
+	serveMux.HandleFunc("GET /api/users/{userID}/following", cfg.handlerGetFollowing)
+	serveMux.HandleFunc("GET /api/timeline", cfg.requireScope(auth.ScopeUsersRead, cfg.handlerGetTimeline))
+	serveMux.HandleFunc("GET /api/sessions", cfg.requireScope(auth.ScopeUsersRead, cfg.handlerGetSessions))
+	serveMux.HandleFunc("GET /api/users/me/api-keys", cfg.requireScope(auth.ScopeUsersRead, cfg.handlerGetAPIKeys))
+	serveMux.HandleFunc("GET /api/users/me/subscription", cfg.requireScope(auth.ScopeUsersRead, cfg.handlerGetSubscription))
 
-	serveMux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
-	serveMux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	serveMux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
-	serveMux.HandleFunc("POST /api/login", apiCfg.handlerLoginUser)
-	serveMux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
-	serveMux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
-	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeUser)
+	serveMux.HandleFunc("POST /admin/reset", cfg.requireRole(auth.RoleAdmin, cfg.handlerReset))
+	serveMux.HandleFunc("POST /admin/users/{userID}/revoke-tokens", cfg.requireRole(auth.RoleAdmin, cfg.handlerRevokeUserTokens))
+	serveMux.HandleFunc("POST /admin/users/{userID}/unlock", cfg.requireRole(auth.RoleAdmin, cfg.handlerUnlockUser))
+	serveMux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
+	serveMux.HandleFunc("POST /api/users/verify", cfg.handlerVerifyEmail)
+	serveMux.HandleFunc("POST /api/users/{userID}/follow", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerFollowUser))
+	serveMux.HandleFunc("POST /api/users/{userID}/block", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerBlockUser))
+	serveMux.HandleFunc("POST /api/users/{userID}/mute", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerMuteUser))
+	serveMux.HandleFunc("POST /api/users/me/api-keys", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerCreateAPIKey))
+	serveMux.HandleFunc("POST /api/users/me/2fa", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerEnrollTwoFactor))
+	serveMux.HandleFunc("POST /api/users/me/2fa/confirm", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerConfirmTwoFactor))
+	serveMux.HandleFunc("POST /api/chirps", cfg.requireScope(auth.ScopeChirpsWrite, cfg.handlerCreateChirp))
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.requireScope(auth.ScopeChirpsWrite, cfg.handlerLikeChirp))
+	serveMux.HandleFunc("POST /api/login", cfg.handlerLoginUser)
+	serveMux.HandleFunc("POST /api/login/2fa", cfg.handlerLoginTwoFactor)
+	serveMux.HandleFunc("POST /api/logout", cfg.handlerLogout)
+	serveMux.HandleFunc("POST /api/logout-all", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerLogoutAll))
+	serveMux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
+	serveMux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	serveMux.HandleFunc("POST /api/password/forgot", cfg.handlerForgotPassword)
+	serveMux.HandleFunc("POST /api/password/reset", cfg.handlerResetPassword)
+	serveMux.HandleFunc("POST /api/polka/webhooks", cfg.handlerPolkaWebhook)
 
-	serveMux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	serveMux.HandleFunc("PUT /admin/users/{userID}/role", cfg.requireRole(auth.RoleAdmin, cfg.handlerUpdateUserRole))
+	serveMux.HandleFunc("PUT /api/users", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerUpdateUser))
 
-	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirpByID)
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.requireScope(auth.ScopeChirpsWrite, cfg.handlerDeleteChirpByID))
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.requireScope(auth.ScopeChirpsWrite, cfg.handlerUnlikeChirp))
+	serveMux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerRevokeSession))
+	serveMux.HandleFunc("DELETE /api/users/me/api-keys/{keyID}", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerRevokeAPIKey))
+	serveMux.HandleFunc("DELETE /api/users/me/2fa", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerDeleteTwoFactor))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerUnfollowUser))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/block", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerUnblockUser))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/mute", cfg.requireScope(auth.ScopeUsersWrite, cfg.handlerUnmuteUser))
 
-	server := &http.Server{Handler: serveMux, Addr: ":" + port}
-	
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	return cfg.middlewareLogging(cfg.middlewareMetrics(cfg.middlewareAuthenticate(cfg.middlewareRateLimit(serveMux))))
 }
\ No newline at end of file
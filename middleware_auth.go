@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/google/uuid"
+)
+
+var ErrAuthenticationRequired = errors.New("authentication required")
+
+const principalContextKey contextKey = "principal"
+
+// adminKeyPrincipal is who a request signed with ADMIN_API_KEY acts as. It
+// is not a user, so it only gets through role checks.
+var adminKeyPrincipal = auth.Principal{Roles: []string{auth.RoleUser, auth.RoleModerator, auth.RoleAdmin}}
+
+// middlewareAuthenticate puts the principal of a valid access token, of a
+// personal API key or of the admin API key, into the request context. Requests without valid
+// credentials carry on unauthenticated; the route decides whether that is
+// allowed.
+func (cfg *apiConfig) middlewareAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resWriter http.ResponseWriter, req *http.Request) {
+		principal, ok, err := cfg.authenticate(req)
+		if err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error checking credentials", err)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(resWriter, req)
+			return
+		}
+		if principal.UserID != uuid.Nil {
+			setRequestUserID(resWriter, principal.UserID)
+		}
+		authenticated := req.WithContext(context.WithValue(req.Context(), principalContextKey, principal))
+		next.ServeHTTP(resWriter, authenticated)
+		// The mux records the route on the request it was given, and the
+		// logging and metrics middleware read it from theirs.
+		req.Pattern = authenticated.Pattern
+	})
+}
+
+func (cfg *apiConfig) authenticate(req *http.Request) (auth.Principal, bool, error) {
+	authorization := req.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		principal, err := auth.ValidateJWT(req.Context(), token, cfg.keyring, cfg.revocations)
+		if errors.Is(err, auth.ErrCheckingRevocations) {
+			return auth.Principal{}, false, err
+		} else if err != nil {
+			return auth.Principal{}, false, nil
+		}
+		// last_used_at is only informational, so failing to record it does
+		// not fail the request.
+		if principal.SessionID != uuid.Nil {
+			if err := cfg.db.TouchSession(req.Context(), principal.SessionID); err != nil {
+				loggerFromContext(req.Context()).Error("could not record session use", "session_id", principal.SessionID, "error", err)
+			}
+		}
+		return principal, true, nil
+	}
+	key, err := auth.GetAPIKey(req.Header)
+	if err != nil {
+		return auth.Principal{}, false, nil
+	}
+	// Admin actions are disabled entirely while no key is configured.
+	if cfg.config.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(cfg.config.AdminAPIKey.Value())) == 1 {
+		return adminKeyPrincipal, true, nil
+	}
+	if strings.HasPrefix(key, auth.APIKeyPrefix) {
+		return cfg.authenticateAPIKey(req.Context(), key)
+	}
+	return auth.Principal{}, false, nil
+}
+
+// authenticateAPIKey looks up a personal API key. The key acts as its user
+// with the user role and only the scopes it was created with.
+func (cfg *apiConfig) authenticateAPIKey(ctx context.Context, key string) (auth.Principal, bool, error) {
+	apiKey, err := cfg.db.GetAPIKeyByHash(ctx, auth.HashToken(key))
+	if err == sql.ErrNoRows {
+		return auth.Principal{}, false, nil
+	} else if err != nil {
+		return auth.Principal{}, false, err
+	}
+	if apiKey.RevokedAt.Valid || (apiKey.ExpiresAt.Valid && !time.Now().Before(apiKey.ExpiresAt.Time)) {
+		return auth.Principal{}, false, nil
+	}
+	if err := cfg.db.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		loggerFromContext(ctx).Error("could not record api key use", "api_key_id", apiKey.ID, "error", err)
+	}
+	return auth.Principal{UserID: apiKey.UserID, APIKeyID: apiKey.ID, Roles: []string{auth.RoleUser}, Scopes: apiKey.Scopes}, true, nil
+}
+
+func principalFromContext(ctx context.Context) (auth.Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(auth.Principal)
+	return principal, ok
+}
+
+// requestUserID is the user a requireScope route was called by.
+func requestUserID(req *http.Request) uuid.UUID {
+	principal, _ := principalFromContext(req.Context())
+	return principal.UserID
+}
+
+// requireScope only lets through users whose credentials carry scope.
+func (cfg *apiConfig) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(resWriter http.ResponseWriter, req *http.Request) {
+		principal, ok := principalFromContext(req.Context())
+		if !ok || principal.UserID == uuid.Nil {
+			respondWithError(resWriter, http.StatusUnauthorized, "a valid access token or api key is required", ErrAuthenticationRequired)
+			return
+		}
+		if !principal.HasScope(scope) {
+			respondWithError(resWriter, http.StatusForbidden, "token is missing the "+scope+" scope", nil)
+			return
+		}
+		next(resWriter, req)
+	}
+}
+
+// requireRole only lets through principals with role or a role above it.
+func (cfg *apiConfig) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(resWriter http.ResponseWriter, req *http.Request) {
+		principal, ok := principalFromContext(req.Context())
+		if !ok {
+			respondWithError(resWriter, http.StatusUnauthorized, "authentication required", ErrAuthenticationRequired)
+			return
+		}
+		if !principal.HasRole(role) {
+			respondWithError(resWriter, http.StatusForbidden, role+" access required", nil)
+			return
+		}
+		next(resWriter, req)
+	}
+}
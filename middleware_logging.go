@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Incoming request IDs longer than this are replaced rather than trusted.
+const maxRequestIDLength = 128
+
+type contextKey string
+
+const loggerContextKey contextKey = "logger"
+
+// responseRecorder remembers what a handler wrote so middleware can report
+// it once the handler returns. It also carries the request scoped logger, so
+// code that only has the ResponseWriter, like respondWithError, can log with it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes int
+	logger *slog.Logger
+	userID uuid.UUID
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// findRecorder looks through any wrappers for the responseRecorder installed
+// by middlewareLogging.
+func findRecorder(resWriter http.ResponseWriter) *responseRecorder {
+	for {
+		if rec, ok := resWriter.(*responseRecorder); ok {
+			return rec
+		}
+		unwrapper, ok := resWriter.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		resWriter = unwrapper.Unwrap()
+	}
+}
+
+// requestLogger returns the logger for the request being written to, or the
+// default logger outside of middlewareLogging.
+func requestLogger(resWriter http.ResponseWriter) *slog.Logger {
+	if rec := findRecorder(resWriter); rec != nil {
+		return rec.logger
+	}
+	return slog.Default()
+}
+
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// setRequestUserID records the authenticated user on the request log record.
+func setRequestUserID(resWriter http.ResponseWriter, userID uuid.UUID) {
+	if rec := findRecorder(resWriter); rec != nil {
+		rec.userID = userID
+		rec.logger = rec.logger.With("user_id", userID)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool { return r < '!' || r > '~' })
+}
+
+// middlewareLogging assigns every request an ID, keeping one sent by a proxy
+// in front of us, and logs a single record per request once it is served.
+func (cfg *apiConfig) middlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resWriter http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		requestID := req.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		resWriter.Header().Set(requestIDHeader, requestID)
+
+		baseLogger := cfg.logger
+		if baseLogger == nil {
+			baseLogger = slog.Default()
+		}
+		rec := &responseRecorder{
+			ResponseWriter: resWriter,
+			logger: baseLogger.With("request_id", requestID),
+		}
+		req = req.WithContext(context.WithValue(req.Context(), loggerContextKey, rec.logger))
+
+		next.ServeHTTP(rec, req)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if rec.status > 499 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", req.Method),
+			slog.String("route", req.Pattern),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", rec.bytes),
+		}
+		if rec.userID != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", rec.userID.String()))
+		}
+		baseLogger.LogAttrs(req.Context(), level, "request served", attrs...)
+	})
+}
+
+// newLogger builds the process logger. format is "text" or "json" and level
+// is one of slog's level names.
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if level != "" {
+		if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", level)
+		}
+	}
+	options := &slog.HandlerOptions{Level: slogLevel}
+
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMiddlewareLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := newLogger(&logs, "json", "info")
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	userID := uuid.New()
+	cfg := &apiConfig{logger: logger}
+
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("GET /things/{id}", func(resWriter http.ResponseWriter, req *http.Request) {
+		setRequestUserID(resWriter, userID)
+		respondWithError(resWriter, http.StatusNotFound, "thing not found", nil)
+	})
+	handler := cfg.middlewareLogging(serveMux)
+
+	cases := []struct{
+		incomingID string
+		expectPropagated bool
+	}{
+		{
+			incomingID: "abc-123",
+			expectPropagated: true,
+		},
+		{
+			incomingID: "",
+			expectPropagated: false,
+		},
+		{
+			incomingID: "has spaces",
+			expectPropagated: false,
+		},
+		{
+			incomingID: strings.Repeat("a", maxRequestIDLength+1),
+			expectPropagated: false,
+		},
+	}
+
+	for _, c := range cases {
+		logs.Reset()
+		req := httptest.NewRequest("GET", "/things/42", nil)
+		if c.incomingID != "" {
+			req.Header.Set(requestIDHeader, c.incomingID)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		requestID := res.Header().Get(requestIDHeader)
+		if (requestID == c.incomingID) != c.expectPropagated || requestID == "" {
+			t.Errorf("Test failed for incoming ID %q, response had %q", c.incomingID, requestID)
+		}
+
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Fatalf("expected a single JSON log record, got %q: %v", logs.String(), err)
+		}
+		expected := map[string]interface{}{
+			"request_id": requestID,
+			"method": "GET",
+			"route": "GET /things/{id}",
+			"status": float64(http.StatusNotFound),
+			"user_id": userID.String(),
+		}
+		for key, value := range expected {
+			if record[key] != value {
+				t.Errorf("Test failed for incoming ID %q: expected %s to be %v, got %v", c.incomingID, key, value, record[key])
+			}
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	cases := []struct{
+		format string
+		level string
+		expectError bool
+	}{
+		{format: "", level: "", expectError: false},
+		{format: "text", level: "debug", expectError: false},
+		{format: "json", level: "WARN", expectError: false},
+		{format: "xml", level: "info", expectError: true},
+		{format: "json", level: "loud", expectError: true},
+	}
+
+	for _, c := range cases {
+		_, err := newLogger(&bytes.Buffer{}, c.format, c.level)
+		if (err != nil) != c.expectError {
+			t.Errorf("Test failed for format %q and level %q: %v", c.format, c.level, err)
+		}
+	}
+}
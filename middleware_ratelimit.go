@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+// middlewareRateLimit applies cfg.rateLimits, keyed by route pattern. Requests
+// with a valid access token share a bucket per user; everyone else shares one
+// per client IP.
+func (cfg *apiConfig) middlewareRateLimit(mux *http.ServeMux) http.Handler {
+	limiter := ratelimit.New()
+	return http.HandlerFunc(func(resWriter http.ResponseWriter, req *http.Request) {
+		_, pattern := mux.Handler(req)
+		limit, ok := cfg.rateLimits[pattern]
+		if !ok {
+			mux.ServeHTTP(resWriter, req)
+			return
+		}
+
+		key := "ip:" + cfg.clientIP(req)
+		if userID := requestUserID(req); userID != uuid.Nil {
+			key = "user:" + userID.String()
+			if cfg.config.RateLimitRedMultiplier > 1 {
+				user, err := cfg.db.GetUserByID(req.Context(), userID)
+				if err == nil && user.IsChirpyRed {
+					limit = limit.Scale(cfg.config.RateLimitRedMultiplier)
+				}
+			}
+		}
+
+		result := limiter.Allow(pattern+"|"+key, limit)
+		header := resWriter.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Per)))
+		if !result.Allowed {
+			// The mux never sees this request, so record the route ourselves.
+			req.Pattern = pattern
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			respondWithError(resWriter, http.StatusTooManyRequests, "too many requests, try again later", nil)
+			return
+		}
+		mux.ServeHTTP(resWriter, req)
+	})
+}
+
+// clientIP uses the address the last proxy saw when TRUST_FORWARDED_FOR is
+// set, since earlier X-Forwarded-For entries are supplied by the client.
+func (cfg *apiConfig) clientIP(req *http.Request) string {
+	if cfg.config.TrustForwardedFor {
+		if forwarded := req.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+
+	"github.com/ansht2000/atServer/internal/migrate"
+)
+
+//go:embed sql/schema/*.sql
+var embeddedSchema embed.FS
+
+var ErrUnknownMigrateCommand = errors.New("usage: atServer migrate up|down|status")
+
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	schema, err := fs.Sub(embeddedSchema, "sql/schema")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, schema)
+}
+
+func migrateUp(ctx context.Context, db *sql.DB) error {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		log.Printf("Applied migration %s\n", migration.Name)
+	}
+	return err
+}
+
+// runMigrateCommand implements "atServer migrate up|down|status".
+func runMigrateCommand(ctx context.Context, db *sql.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return ErrUnknownMigrateCommand
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %s\n", migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rolled back %s\n", migration.Name)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%-20s %s\n", appliedAt, status.Migration.Name)
+		}
+		return nil
+	default:
+		return ErrUnknownMigrateCommand
+	}
+}
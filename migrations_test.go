@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := newMigrator(nil)
+	if err != nil {
+		t.Fatalf("could not load embedded migrations: %v", err)
+	}
+	for i, migration := range migrator.Migrations() {
+		if migration.Version != int64(i+1) {
+			t.Errorf("expected migration %s to have version %d", migration.Name, i+1)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %s has no down section", migration.Name)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ansht2000/atServer/internal/auth"
+	"github.com/ansht2000/atServer/internal/database"
+	"github.com/google/uuid"
+)
+
+// revocationStore answers auth.Revocations from the database.
+type revocationStore struct {
+	db database.Store
+}
+
+func (s revocationStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return s.db.IsAccessTokenRevoked(ctx, tokenID)
+}
+
+func (s revocationStore) TokensValidAfter(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	validAfter, err := s.db.GetUserTokensValidAfter(ctx, userID)
+	// A deleted user has nothing left for their tokens to reach.
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	return validAfter.Time, nil
+}
+
+func newRevocationCache(db database.Store, ttl time.Duration) *auth.RevocationCache {
+	return auth.NewRevocationCache(revocationStore{db: db}, ttl)
+}
+
+// revokeAccessToken rejects the access token principal came from for the
+// rest of its lifetime.
+func (cfg *apiConfig) revokeAccessToken(ctx context.Context, principal auth.Principal) error {
+	if principal.TokenID == "" {
+		return nil
+	}
+	err := cfg.db.CreateRevokedAccessToken(ctx, database.CreateRevokedAccessTokenParams{
+		Jti: principal.TokenID,
+		UserID: principal.UserID,
+		ExpiresAt: principal.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	cfg.revocations.RevokeToken(principal.TokenID, principal.ExpiresAt)
+	return nil
+}
+
+// revokeUserAccessTokens rejects every access token of a user issued so far.
+func (cfg *apiConfig) revokeUserAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	validAfter, err := cfg.db.RevokeUserTokens(ctx, database.RevokeUserTokensParams{
+		ValidAfter: time.Now().UTC(),
+		ID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	cfg.revocations.RevokeUserTokens(userID, validAfter.Time)
+	return nil
+}
+
+// signOutEverywhere revokes every access token and session of a user.
+func (cfg *apiConfig) signOutEverywhere(ctx context.Context, userID uuid.UUID) error {
+	if err := cfg.revokeUserAccessTokens(ctx, userID); err != nil {
+		return err
+	}
+	return cfg.db.RevokeRefreshTokensByUserID(ctx, userID)
+}
+
+// handlerLogout signs out the session the request was made with and revokes
+// the access token it was made with.
+func (cfg *apiConfig) handlerLogout(resWriter http.ResponseWriter, req *http.Request) {
+	principal, ok := principalFromContext(req.Context())
+	if !ok || principal.TokenID == "" {
+		respondWithError(resWriter, http.StatusUnauthorized, "a valid access token is required", ErrAuthenticationRequired)
+		return
+	}
+	if err := cfg.revokeAccessToken(req.Context(), principal); err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking access token", err)
+		return
+	}
+	if principal.SessionID != uuid.Nil {
+		revokeParams := database.RevokeSessionParams{FamilyID: principal.SessionID, UserID: principal.UserID}
+		if _, err := cfg.db.RevokeSession(req.Context(), revokeParams); err != nil {
+			respondWithError(resWriter, http.StatusInternalServerError, "error revoking session", err)
+			return
+		}
+	}
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRevokeUserTokens signs a user out everywhere, for when an account is
+// compromised or banned.
+func (cfg *apiConfig) handlerRevokeUserTokens(resWriter http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(resWriter, http.StatusBadRequest, "invalid user id", err)
+		return
+	}
+	err = cfg.signOutEverywhere(req.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(resWriter, http.StatusNotFound, "user not found", err)
+		return
+	} else if err != nil {
+		respondWithError(resWriter, http.StatusInternalServerError, "error revoking tokens", err)
+		return
+	}
+	requestLogger(resWriter).Info("revoked user tokens", "revoked_user_id", userID)
+	resWriter.WriteHeader(http.StatusNoContent)
+}
+
+// sweepRevokedAccessTokens forgets revocations of tokens that have expired
+// since, in the database and in the cache.
+func (cfg *apiConfig) sweepRevokedAccessTokens(ctx context.Context) error {
+	cfg.revocations.Purge()
+	_, err := cfg.db.DeleteExpiredRevokedAccessTokens(ctx, time.Now().UTC())
+	return err
+}
+
+func (cfg *apiConfig) runRevocationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.sweepRevokedAccessTokens(ctx); err != nil {
+				log.Printf("error sweeping revoked access tokens: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, user_id, name, key_hash, prefix, scopes, created_at, expires_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), $6)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1;
+
+-- name: ListAPIKeysByUserID :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+-- last_used_at is only written about once a minute, not on every request.
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
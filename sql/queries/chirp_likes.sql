@@ -0,0 +1,25 @@
+-- name: LikeChirp :exec
+-- Liking a chirp twice leaves the first like in place.
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: CountLikesByChirpIDs :many
+SELECT chirp_id, COUNT(*) AS like_count FROM chirp_likes
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+GROUP BY chirp_id;
+
+-- name: ListChirpIDsLikedByUser :many
+-- Which of the given chirps the user has liked.
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = ANY(@chirp_ids::uuid[]);
+
+-- name: ListChirpsLikedByUser :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at FROM chirps
+JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id
+WHERE chirp_likes.user_id = $1 AND chirps.deleted_at IS NULL
+ORDER BY chirp_likes.created_at DESC, chirps.id DESC;
@@ -1,17 +1,67 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
 RETURNING *;
 
 -- name: GetChirps :many
 SELECT * FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: DeleteChirpByID :one
-DELETE FROM chirps
-WHERE id = $1
-RETURNING *;
\ No newline at end of file
+-- The row stays behind as a tombstone, so replies keep their place in the
+-- thread, but the body is gone.
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (
+    sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at'), sqlc.narg('after_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.narg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (
+    sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at'), sqlc.narg('before_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.narg('limit');
+
+-- name: CountRepliesByChirpIDs :many
+SELECT in_reply_to, COUNT(*) AS reply_count FROM chirps
+WHERE in_reply_to = ANY(@chirp_ids::uuid[]) AND deleted_at IS NULL
+GROUP BY in_reply_to;
+
+-- name: GetChirpThread :many
+-- Every chirp in the conversation that $1 is part of, tombstones included,
+-- with its depth below the chirp that started the conversation.
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.in_reply_to FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+), thread AS (
+    SELECT chirps.*, 0 AS depth FROM chirps
+    WHERE chirps.id = (SELECT ancestors.id FROM ancestors WHERE ancestors.in_reply_to IS NULL)
+    UNION ALL
+    SELECT reply.*, thread.depth + 1 FROM chirps reply
+    JOIN thread ON reply.in_reply_to = thread.id
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, depth FROM thread
+ORDER BY depth, created_at, id;
@@ -0,0 +1,11 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token_hash, created_at, user_id, email, expires_at, used_at)
+VALUES ($1, NOW(), $2, $3, $4, NULL)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+-- expires_at is written in UTC, so now is passed in UTC too.
+UPDATE email_verification_tokens
+SET used_at = sqlc.arg(now)::timestamp
+WHERE token_hash = sqlc.arg(token_hash) AND used_at IS NULL AND expires_at > sqlc.arg(now)::timestamp
+RETURNING *;
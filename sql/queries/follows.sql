@@ -0,0 +1,74 @@
+-- name: FollowUser :exec
+-- Following someone twice leaves the first follow in place.
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at FROM follows
+WHERE followee_id = $1
+ORDER BY created_at DESC, follower_id DESC;
+
+-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at FROM follows
+WHERE follower_id = $1
+ORDER BY created_at DESC, followee_id DESC;
+
+-- name: BlockUser :exec
+-- Blocking someone also ends any follow between the two of them.
+WITH unfollowed AS (
+    DELETE FROM follows
+    WHERE (follower_id = @blocker_id AND followee_id = @blocked_id)
+    OR (follower_id = @blocked_id AND followee_id = @blocker_id)
+)
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES (@blocker_id, @blocked_id, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: IsBlockedBetween :one
+-- Whether either user has blocked the other.
+SELECT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = @user_id AND blocked_id = @other_user_id)
+    OR (blocker_id = @other_user_id AND blocked_id = @user_id)
+);
+
+-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (muter_id, muted_id) DO NOTHING;
+
+-- name: UnmuteUser :exec
+DELETE FROM user_mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: ListTimeline :many
+-- Chirps by the users that user_id follows, newest first, leaving out anyone
+-- blocked in either direction or muted by user_id.
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = @user_id
+AND chirps.deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = @user_id AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = @user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = @user_id AND user_mutes.muted_id = chirps.user_id
+)
+AND (
+    sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('before_created_at'), sqlc.narg('before_id')::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,36 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+-- Failures and lockouts are forgotten once a key has been quiet since stale_before.
+-- updated_at is written from now rather than NOW(), so both are in UTC.
+INSERT INTO login_throttles (key, user_id, created_at, updated_at, failed_attempts, lockouts, locked_until)
+VALUES (sqlc.arg(key), sqlc.arg(user_id), sqlc.arg(now), sqlc.arg(now), 1, 0, NULL)
+ON CONFLICT (key) DO UPDATE
+SET failed_attempts = CASE WHEN login_throttles.updated_at < sqlc.arg(stale_before) THEN 1 ELSE login_throttles.failed_attempts + 1 END,
+    lockouts = CASE WHEN login_throttles.updated_at < sqlc.arg(stale_before) THEN 0 ELSE login_throttles.lockouts END,
+    updated_at = sqlc.arg(now)
+RETURNING *;
+
+-- name: LockLoginThrottle :one
+-- updated_at is compared against RecordLoginFailure's stale_before, so it is
+-- written in UTC from now as well.
+UPDATE login_throttles
+SET failed_attempts = 0, lockouts = lockouts + 1, locked_until = $2, updated_at = $3
+WHERE key = $1
+RETURNING *;
+
+-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE key = $1;
+
+-- name: CreateLoginLockoutEvent :exec
+INSERT INTO login_lockout_events (id, created_at, throttle_key, user_id, event, failed_attempts, locked_until)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5);
+
+-- name: GetLoginLockoutEventsByUserID :many
+SELECT * FROM login_lockout_events
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 50;
@@ -0,0 +1,15 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, created_at, user_id, expires_at, used_at)
+VALUES ($1, NOW(), $2, $3, NULL)
+RETURNING *;
+
+-- name: ConsumePasswordResetToken :one
+-- expires_at is written in UTC, so now is passed in UTC too.
+UPDATE password_reset_tokens
+SET used_at = sqlc.arg(now)::timestamp
+WHERE token_hash = sqlc.arg(token_hash) AND used_at IS NULL AND expires_at > sqlc.arg(now)::timestamp
+RETURNING *;
+
+-- name: DeletePasswordResetTokensByUserID :exec
+DELETE FROM password_reset_tokens
+WHERE user_id = $1;
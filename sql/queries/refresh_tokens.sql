@@ -1,13 +1,55 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(created_at, updated_at, expires_at, revoked_at, token, user_id)
-VALUES (NOW(), NOW(), NOW() + INTERVAL '60 days', NULL, $1, $2)
+INSERT INTO refresh_tokens(created_at, updated_at, expires_at, revoked_at, token_hash, user_id, family_id, user_agent, ip_address, last_used_at)
+VALUES (NOW(), NOW(), NOW() + INTERVAL '60 days', NULL, $1, $2, $3, $4, $5, NOW())
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token_hash = $1;
+
+-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOtherRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
+
+-- name: ListSessionsByUserID :many
+-- A session is a token family; only its live token is listed, along with
+-- when the family was started.
+SELECT refresh_tokens.*, (
+    SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id
+)::timestamp AS signed_in_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchSession :exec
+-- last_used_at is only written about once a minute, not on every request.
+UPDATE refresh_tokens
+SET last_used_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL AND last_used_at < NOW() - INTERVAL '1 minute';
@@ -0,0 +1,15 @@
+-- name: CreateRevokedAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, user_id, revoked_at, expires_at)
+VALUES ($1, $2, NOW(), $3)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM revoked_access_tokens WHERE jti = $1
+);
+
+-- name: DeleteExpiredRevokedAccessTokens :execrows
+-- Expired tokens are rejected anyway, so their entries are no longer needed.
+-- expires_at is written in UTC, so the cutoff is passed in UTC too.
+DELETE FROM revoked_access_tokens
+WHERE expires_at < sqlc.arg(cutoff)::timestamp;
@@ -0,0 +1,36 @@
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, current_period_start, current_period_end)
+VALUES ($1, NOW(), NOW(), $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET status = EXCLUDED.status,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetSubscriptionByUserID :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: UpdateSubscriptionStatus :one
+UPDATE subscriptions
+SET status = $2, updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: ExpireSubscriptions :many
+-- Periods are stored in UTC, so now is passed in UTC too.
+UPDATE subscriptions
+SET status = 'expired', updated_at = NOW()
+WHERE status = 'active' AND current_period_end < sqlc.arg(now)::timestamp
+RETURNING *;
+
+-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, created_at, user_id, event, period_start, period_end)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4);
+
+-- name: GetSubscriptionEventsByUserID :many
+SELECT * FROM subscription_events
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 50;
@@ -0,0 +1,47 @@
+-- name: UpsertTOTPEnrollment :one
+-- Starting over is allowed until the enrollment is confirmed.
+INSERT INTO user_totp (user_id, created_at, secret, confirmed_at, last_used_step)
+VALUES ($1, NOW(), $2, NULL, 0)
+ON CONFLICT (user_id) DO UPDATE
+SET created_at = NOW(), secret = EXCLUDED.secret, last_used_step = 0
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetTOTPByUserID :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTP :one
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseTOTPStep :execrows
+-- A code is only accepted once, and never after a later one.
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateTOTPRecoveryCode :exec
+INSERT INTO totp_recovery_codes (id, code_hash, created_at, user_id, used_at)
+VALUES (gen_random_uuid(), $1, NOW(), $2, NULL);
+
+-- name: ListUnusedTOTPRecoveryCodesByUserID :many
+-- Codes are hashed with a salt, so a code is checked against each of its
+-- user's hashes rather than looked up.
+SELECT * FROM totp_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseTOTPRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: DeleteTOTPRecoveryCodesByUserID :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
@@ -11,8 +11,12 @@ SELECT * FROM users
 WHERE email = $1;
 
 -- name: UpdateUserEmailPasswordByID :one
+-- A new email address has to be verified again.
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
+SET email = $1,
+    hashed_password = $2,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
 WHERE id = $3
 RETURNING *;
 
@@ -20,4 +24,43 @@ RETURNING *;
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: DowngradeUserByID :one
+UPDATE users
+SET is_chirpy_red = false
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: UpdateUserPasswordByID :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserTokensValidAfter :one
+SELECT tokens_valid_after FROM users
+WHERE id = $1;
+
+-- name: RevokeUserTokens :one
+-- Access tokens issued before tokens_valid_after are rejected. The column has
+-- no time zone, so valid_after is passed in UTC rather than taken from NOW().
+UPDATE users
+SET tokens_valid_after = sqlc.arg(valid_after)::timestamp
+WHERE id = sqlc.arg(id)
+RETURNING tokens_valid_after;
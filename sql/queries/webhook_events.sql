@@ -0,0 +1,14 @@
+-- name: CreateWebhookEvent :execrows
+INSERT INTO webhook_events (id, event, received_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: DeleteWebhookEvent :exec
+DELETE FROM webhook_events
+WHERE id = $1;
+
+-- name: DeleteWebhookEventsReceivedBefore :execrows
+-- Signed deliveries older than the allowed skew are rejected anyway, so their
+-- ids no longer need remembering.
+DELETE FROM webhook_events
+WHERE received_at < $1;
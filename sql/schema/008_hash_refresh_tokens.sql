@@ -0,0 +1,15 @@
+-- +goose Up
+-- Only a SHA-256 digest of each refresh token is stored. Existing tokens are
+-- hashed in place so clients holding them stay logged in.
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+-- A digest cannot be turned back into its token, so every session is dropped.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
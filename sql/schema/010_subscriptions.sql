@@ -0,0 +1,33 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL,
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX subscriptions_active_period_end_idx ON subscriptions (current_period_end)
+WHERE status = 'active';
+
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    event TEXT NOT NULL,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX subscription_events_user_id_created_at_idx ON subscription_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
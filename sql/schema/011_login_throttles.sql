@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    user_id UUID,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    failed_attempts INTEGER NOT NULL,
+    lockouts INTEGER NOT NULL,
+    locked_until TIMESTAMP,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE login_lockout_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    throttle_key TEXT NOT NULL,
+    user_id UUID,
+    event TEXT NOT NULL,
+    failed_attempts INTEGER NOT NULL,
+    locked_until TIMESTAMP,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX login_lockout_events_user_id_created_at_idx ON login_lockout_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE login_lockout_events;
+DROP TABLE login_throttles;
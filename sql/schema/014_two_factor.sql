@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT NOT NULL,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Recovery codes are short enough to brute force from a fast hash, so they
+-- are stored like passwords: salted, which rules out looking them up by hash.
+CREATE TABLE totp_recovery_codes (
+    id UUID PRIMARY KEY,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX totp_recovery_codes_user_id_idx ON totp_recovery_codes (user_id);
+
+-- +goose Down
+DROP TABLE totp_recovery_codes;
+DROP TABLE user_totp;
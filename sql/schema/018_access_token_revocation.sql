@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN tokens_valid_after TIMESTAMP;
+
+CREATE TABLE revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    revoked_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id
+        FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX revoked_access_tokens_expires_at_idx ON revoked_access_tokens (expires_at);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
+
+ALTER TABLE users
+DROP COLUMN tokens_valid_after;
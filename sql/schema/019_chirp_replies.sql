@@ -0,0 +1,26 @@
+-- +goose Up
+-- Deleting a chirp only tombstones it, so a reply loses its parent only when
+-- the parent's author is deleted and their chirps cascade away with them. The
+-- reply is then detached and starts a thread of its own. DeleteUsers removes
+-- every user and so every chirp at once, which leaves nothing detached;
+-- deleting a single account would have to keep its chirps as tombstones.
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID,
+ADD COLUMN deleted_at TIMESTAMP,
+ADD CONSTRAINT fk_in_reply_to
+    FOREIGN KEY (in_reply_to)
+    REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to);
+
+-- +goose Down
+DROP INDEX chirps_in_reply_to_idx;
+
+-- Tombstones only existed to hold replies in place.
+DELETE FROM chirps
+WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE chirps
+DROP CONSTRAINT fk_in_reply_to,
+DROP COLUMN deleted_at,
+DROP COLUMN in_reply_to;
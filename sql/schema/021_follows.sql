@@ -0,0 +1,51 @@
+-- +goose Up
+CREATE TABLE follows (
+    follower_id UUID NOT NULL,
+    followee_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT fk_follower_id
+        FOREIGN KEY (follower_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_followee_id
+        FOREIGN KEY (followee_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT follows_not_self CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id);
+
+CREATE TABLE user_blocks (
+    blocker_id UUID NOT NULL,
+    blocked_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CONSTRAINT fk_blocker_id
+        FOREIGN KEY (blocker_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_blocked_id
+        FOREIGN KEY (blocked_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT user_blocks_not_self CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX user_blocks_blocked_id_idx ON user_blocks (blocked_id);
+
+CREATE TABLE user_mutes (
+    muter_id UUID NOT NULL,
+    muted_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (muter_id, muted_id),
+    CONSTRAINT fk_muter_id
+        FOREIGN KEY (muter_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_muted_id
+        FOREIGN KEY (muted_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT user_mutes_not_self CHECK (muter_id <> muted_id)
+);
+
+-- +goose Down
+DROP TABLE user_mutes;
+DROP TABLE user_blocks;
+DROP TABLE follows;